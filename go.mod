@@ -8,5 +8,5 @@ require (
 	github.com/oklog/ulid/v2 v2.0.2
 	gopkg.in/yaml.v2 v2.2.8
 	helm.sh/helm/v3 v3.3.4
-	sigs.k8s.io/yaml v1.2.0 // indirect
+	sigs.k8s.io/yaml v1.2.0
 )
@@ -1,8 +1,13 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"os"
+	"strings"
 
+	"github.com/wahabmk/helm-pusher/pkg/helm"
+	"github.com/wahabmk/helm-pusher/pkg/random"
 	"github.com/wahabmk/helm-pusher/pusher"
 )
 
@@ -18,15 +23,272 @@ const (
 	username       = "admin"
 	password       = "password1234"
 	templateChart  = "/tmp/testchart"
+	// Distribution of packaged chart sizes, e.g. "fixed:1Mi", "uniform:4K:1Mi", "lognormal:64K:1.5"
+	// or "histogram:/path/to/sizes.txt". Leave empty to push charts at their natural size.
+	packageSize         = ""
+	compressiblePadding = false
+	// Content added to every chart. All zero pushes the template chart as it is.
+	nTemplates    = 0
+	valuesSize    = int64(0)
+	valuesDepth   = 1
+	valuesSchema  = false
+	nSubcharts    = 0
+	subchartDepth = 0
+	chartLock     = false
+	// Chart naming strategy: "ulid", "words:<n>" or "list:/path/to/names.txt".
+	naming = "ulid"
+	// Prefix names with an ID unique to this run.
+	runPrefix = false
+	// Probability of reusing a previously generated name.
+	nameCollisions = 0.0
+	// Chart versioning strategy: "random", "train" or
+	// "train:<minor probability>:<major probability>:<prerelease probability>:<build probability>".
+	versioning = "random"
+	// Distribution of the number of versions of each chart, e.g. "zipf:1.5:5000" or
+	// "histogram:/path/to/versions.txt". Leave empty for a uniform number between 1 and nVersions.
+	versionsPerChart = ""
+	// Probabilities with which each optional Chart.yaml field is generated, and fractions of charts made library or
+	// deprecated charts. All zero keeps the Chart.yaml of the template chart.
+	appVersionField  = 0.0
+	descriptionField = 0.0
+	keywordsField    = 0.0
+	maintainersField = 0.0
+	homeField        = 0.0
+	sourcesField     = 0.0
+	iconField        = 0.0
+	annotationsField = 0.0
+	kubeVersionField = 0.0
+	libraryCharts    = 0.0
+	deprecatedCharts = 0.0
+	// Fraction of charts generated as legacy apiVersion v1 charts with requirements.yaml.
+	legacyCharts = 0.0
+	// Fraction of pushes replaced by malformed or malicious archives, which the registry should reject with 4xx.
+	hostileCharts = 0.0
+	// Probabilities with which each version of a chart adds a template, removes one, changes its values or bumps
+	// a dependency, and the largest fraction by which its content size drifts, relative to the version before it.
+	addTemplates     = 0.0
+	removeTemplates  = 0.0
+	changeValues     = 0.0
+	bumpDependencies = 0.0
+	sizeDrift        = 0.0
+	// Chart archive format: "default", "compatible" with `helm package`, or byte-for-byte "reproducible".
+	packaging = "default"
+	// Package charts into request bodies as they are sent instead of buffering them. Sending them with a
+	// precomputed length instead of chunked encoding requires reproducible packaging.
+	streamUploads = false
+	streamSized   = false
+	// Compress the template chart once and only generate Chart.yaml for every push. Not used with packageSize.
+	packagingCache = false
+	// Default directory that the generate command writes charts to.
+	corpusDir = "/tmp/charts"
+	// Push directories of chart archives without a manifest in the order they were modified, instead of by name
+	// and version, and space them out like the original uploads, replaySpeedup times faster, if it is set.
+	originalOrder = false
+	replaySpeedup = 0.0
+	// Number of times a chart from a directory is pushed again when it fails and repeatFailures is set.
+	corpusRetries = 3
+	// Registry API that charts are pushed to: "chartmuseum", "oci" for an OCI registry at url, such as
+	// "http://127.0.0.1:5000", where each chart is pushed to the repository <ociNamespace>/<name>, or "harbor"
+	// for the chart repositories of a Harbor instance at url, such as "https://harbor.example.com". "artifactory"
+	// and "nexus" PUT charts to the Helm repository at url, such as "https://nexus.example.com/repository/helm-hosted",
+	// with their checksums.
+	registry     = "chartmuseum"
+	ociNamespace = "charts"
+	// Size of the PATCH requests that blobs are uploaded to OCI registries in, e.g. "64K". Leave empty to upload
+	// each blob in a single PUT.
+	ociChunkSize = ""
+	// Also push each chart to this many other namespaces, and mount blobs that were pushed to another repository
+	// from it instead of uploading them again.
+	ociCopies = 0
+	ociMount  = false
+	// Spread charts across this many ChartMuseum tenants, served tenantDepth levels deep under /api, such as
+	// /api/org3/repo17/charts. Tenant i gets a share of charts proportional to 1/(i+1)^tenantSkew.
+	tenants     = 0
+	tenantDepth = 2
+	tenantSkew  = 0.0
+	// Comma separated Harbor projects that charts are spread across, and whether to create those that do not exist.
+	harborProjects       = "library"
+	createHarborProjects = false
 )
 
+// options returns the options with which charts are generated and pushed.
+func options() ([]pusher.Option, error) {
+	var opts []pusher.Option
+	if packageSize != "" {
+		dist, err := random.ParseDistribution(packageSize)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, pusher.WithPackageSize(dist, compressiblePadding))
+	}
+
+	if nTemplates > 0 || valuesSize > 0 || valuesSchema || nSubcharts > 0 {
+		opts = append(opts, pusher.WithStructure(pusher.Structure{
+			Templates:     nTemplates,
+			ValuesSize:    valuesSize,
+			ValuesDepth:   valuesDepth,
+			Schema:        valuesSchema,
+			Subcharts:     nSubcharts,
+			SubchartDepth: subchartDepth,
+			Lock:          chartLock,
+		}))
+	}
+
+	namer, err := pusher.ParseNamer(naming)
+	if err != nil {
+		return nil, err
+	}
+	if runPrefix {
+		namer = pusher.PrefixNamer{Prefix: pusher.NewRunID(), Namer: namer}
+	}
+	if nameCollisions > 0 {
+		namer = &pusher.CollidingNamer{Namer: namer, Probability: nameCollisions}
+	}
+	opts = append(opts, pusher.WithNamer(namer))
+
+	versioner, err := pusher.ParseVersioner(versioning)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, pusher.WithVersioner(versioner))
+
+	if versionsPerChart != "" {
+		dist, err := random.ParseDistribution(versionsPerChart)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, pusher.WithVersionsPerChart(dist))
+	}
+
+	m := pusher.MetadataProbabilities{
+		AppVersion:  appVersionField,
+		Description: descriptionField,
+		Keywords:    keywordsField,
+		Maintainers: maintainersField,
+		Home:        homeField,
+		Sources:     sourcesField,
+		Icon:        iconField,
+		Annotations: annotationsField,
+		KubeVersion: kubeVersionField,
+		Library:     libraryCharts,
+		Deprecated:  deprecatedCharts,
+	}
+	if m != (pusher.MetadataProbabilities{}) {
+		opts = append(opts, pusher.WithMetadata(m))
+	}
+
+	if legacyCharts > 0 {
+		opts = append(opts, pusher.WithLegacyCharts(legacyCharts))
+	}
+
+	if hostileCharts > 0 {
+		opts = append(opts, pusher.WithHostileCharts(hostileCharts))
+	}
+
+	if addTemplates > 0 || removeTemplates > 0 || changeValues > 0 || bumpDependencies > 0 || sizeDrift > 0 {
+		opts = append(opts, pusher.WithMutation(pusher.Mutation{
+			AddTemplate:      addTemplates,
+			RemoveTemplate:   removeTemplates,
+			ChangeValues:     changeValues,
+			BumpDependencies: bumpDependencies,
+			SizeDrift:        sizeDrift,
+		}))
+	}
+
+	mode, err := helm.ParseMode(packaging)
+	if err != nil {
+		return nil, err
+	}
+	if mode != helm.Default {
+		opts = append(opts, pusher.WithPackaging(mode))
+	}
+
+	if packagingCache {
+		opts = append(opts, pusher.WithPackagingCache())
+	}
+
+	if streamUploads {
+		opts = append(opts, pusher.WithStreaming(streamSized))
+	}
+
+	if originalOrder {
+		opts = append(opts, pusher.WithOriginalOrder(replaySpeedup))
+	}
+
+	opts = append(opts, pusher.WithCorpusRetries(corpusRetries))
+
+	switch registry {
+	case "chartmuseum":
+		if tenants > 0 {
+			t := pusher.NewChartMuseum(url, username, password)
+			t.Tenants, t.TenantDepth, t.TenantSkew = tenants, tenantDepth, tenantSkew
+			opts = append(opts, pusher.WithTarget(t))
+		}
+	case "oci":
+		t := pusher.NewOCI(url, ociNamespace, username, password)
+		if ociChunkSize != "" {
+			if t.ChunkSize, err = random.ParseInt(ociChunkSize); err != nil {
+				return nil, err
+			}
+		}
+		t.Copies = ociCopies
+		t.Mount = ociMount
+		opts = append(opts, pusher.WithTarget(t))
+	case "harbor":
+		t := pusher.NewHarbor(url, strings.Split(harborProjects, ","), username, password)
+		t.CreateProjects = createHarborProjects
+		opts = append(opts, pusher.WithTarget(t))
+	case "artifactory":
+		opts = append(opts, pusher.WithTarget(pusher.NewArtifactory(url, username, password)))
+	case "nexus":
+		opts = append(opts, pusher.WithTarget(pusher.NewNexus(url, username, password)))
+	default:
+		return nil, fmt.Errorf("unknown registry %q, expected chartmuseum, oci, harbor, artifactory or nexus", registry)
+	}
+
+	return opts, nil
+}
+
 func main() {
-	p, err := pusher.New(nCharts, nVersions, nRoutines, url, username, password, repeatFailures, verbose)
+	cmd, args := "push", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+
+	flags := flag.NewFlagSet(cmd, flag.ExitOnError)
+	var dir *string
+	switch cmd {
+	case "push":
+		dir = flags.String("from-dir", "", "push the charts written to this directory by the generate command instead of generating them")
+	case "generate":
+		dir = flags.String("dir", corpusDir, "directory to write the packaged charts and their manifest to")
+	default:
+		fmt.Printf("unknown command %q, expected push or generate\n", cmd)
+		return
+	}
+	flags.Parse(args)
+
+	opts, err := options()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	p, err := pusher.New(nCharts, nVersions, nRoutines, url, username, password, repeatFailures, verbose, opts...)
 	if err != nil {
 		println(err)
+		return
 	}
 
-	if err := p.Push(); err != nil {
+	switch {
+	case cmd == "generate":
+		err = p.Generate(*dir)
+	case *dir != "":
+		err = p.PushDir(*dir)
+	default:
+		err = p.Push()
+	}
+	if err != nil {
 		fmt.Println(err)
 	}
 }
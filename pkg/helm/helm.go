@@ -8,63 +8,153 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"path"
 	"path/filepath"
+	"sort"
 	"time"
 
-	"gopkg.in/yaml.v2"
+	yamlv2 "gopkg.in/yaml.v2"
 	"helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chartutil"
+	"sigs.k8s.io/yaml"
 )
 
 var (
 	headerBytes = []byte("+aHR0cHM6Ly95b3V0dS5iZS96OVV6MWljandyTQo=")
+
+	// ReproducibleModTime is the modification time of every entry written in Reproducible mode.
+	ReproducibleModTime = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
 )
 
-func PackageChart(c *chart.Chart) (io.Reader, error) {
-	if err := c.Validate(); err != nil {
-		return nil, fmt.Errorf("chart validation: %w", err)
+// Mode controls how charts are written to archives.
+type Mode int
+
+const (
+	// Default stamps every entry with the current time and marshals Chart.yaml with gopkg.in/yaml.v2,
+	// which writes lowercased keys and empty fields.
+	Default Mode = iota
+	// Compatible writes the same archive as `helm package` (chartutil.Save). Like Helm, entries are
+	// stamped with the current time so archives only match byte-for-byte when written at the same time.
+	Compatible
+	// Reproducible writes byte-for-byte identical archives for identical charts. It is Compatible
+	// with fixed modification times, entries sorted by name and directory entries for every directory.
+	Reproducible
+)
+
+func (m Mode) String() string {
+	switch m {
+	case Compatible:
+		return "compatible"
+	case Reproducible:
+		return "reproducible"
+	default:
+		return "default"
+	}
+}
+
+// ParseMode returns the Mode with the given name.
+func ParseMode(s string) (Mode, error) {
+	for _, m := range []Mode{Default, Compatible, Reproducible} {
+		if m.String() == s {
+			return m, nil
+		}
 	}
+	return Default, fmt.Errorf("unknown packaging mode %q", s)
+}
+
+// Packager writes charts to gzipped tar archives.
+type Packager struct {
+	Mode Mode
+}
+
+// PackageChart writes c to an archive in Default mode.
+func PackageChart(c *chart.Chart) (*bytes.Buffer, error) {
+	return (&Packager{}).Package(c)
+}
 
+// Package writes c to an archive.
+func (p *Packager) Package(c *chart.Chart) (*bytes.Buffer, error) {
 	buf := bytes.NewBuffer([]byte{})
+	if err := p.Write(buf, c); err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+// Write writes c to an archive that is streamed to out as it is written.
+func (p *Packager) Write(out io.Writer, c *chart.Chart) error {
+	if err := c.Validate(); err != nil {
+		return fmt.Errorf("chart validation: %w", err)
+	}
 
 	// Wrap in gzip writer
-	zipper := gzip.NewWriter(buf)
+	zipper := gzip.NewWriter(out)
 	zipper.Header.Extra = headerBytes
 	zipper.Header.Comment = "Helm"
 
 	// Wrap in tar writer
 	twriter := tar.NewWriter(zipper)
-	// rollback := false
-	defer func() {
-		twriter.Close()
-		zipper.Close()
-	}()
 
-	if err := writeTarContents(twriter, c, ""); err != nil {
-		return nil, err
+	w := newArchiveWriter(p.Mode, func(h *tar.Header, body []byte) error {
+		if err := twriter.WriteHeader(h); err != nil {
+			return err
+		}
+		_, err := twriter.Write(body)
+		return err
+	})
+	if err := w.writeTarContents(c, ""); err != nil {
+		return err
+	}
+	if err := twriter.Close(); err != nil {
+		return err
 	}
+	return zipper.Close()
+}
 
-	return buf, nil
+// archiveWriter writes the entries of a chart archive.
+type archiveWriter struct {
+	mode Mode
+	// emit writes a single entry.
+	emit func(h *tar.Header, body []byte) error
+	// dirs has the directories for which an entry has been written.
+	dirs map[string]bool
 }
 
-func writeTarContents(out *tar.Writer, c *chart.Chart, prefix string) error {
-	base := filepath.Join(prefix, c.Name())
+func newArchiveWriter(mode Mode, emit func(h *tar.Header, body []byte) error) *archiveWriter {
+	return &archiveWriter{mode: mode, emit: emit, dirs: map[string]bool{}}
+}
+
+func (w *archiveWriter) marshal(v interface{}) ([]byte, error) {
+	if w.mode == Default {
+		return yamlv2.Marshal(v)
+	}
+	return yaml.Marshal(v)
+}
 
+func (w *archiveWriter) marshalMetadata(md *chart.Metadata) ([]byte, error) {
 	// Pull out the dependencies of a v1 Chart, since there's no way
 	// to tell the serializer to skip a field for just this use case
-	savedDependencies := c.Metadata.Dependencies
-	if c.Metadata.APIVersion == chart.APIVersionV1 {
-		c.Metadata.Dependencies = nil
+	savedDependencies := md.Dependencies
+	if md.APIVersion == chart.APIVersionV1 {
+		md.Dependencies = nil
 	}
-	// Save Chart.yaml
-	cdata, err := yaml.Marshal(c.Metadata)
-	if c.Metadata.APIVersion == chart.APIVersionV1 {
-		c.Metadata.Dependencies = savedDependencies
+	data, err := w.marshal(md)
+	if md.APIVersion == chart.APIVersionV1 {
+		md.Dependencies = savedDependencies
 	}
+	return data, err
+}
+
+func (w *archiveWriter) writeTarContents(c *chart.Chart, prefix string) error {
+	base := filepath.Join(prefix, c.Name())
+
+	// Save Chart.yaml
+	cdata, err := w.marshalMetadata(c.Metadata)
 	if err != nil {
 		return err
 	}
-	if err := writeToTar(out, filepath.Join(base, chartutil.ChartfileName), cdata); err != nil {
+	if err := w.writeToTar(filepath.Join(base, chartutil.ChartfileName), cdata); err != nil {
 		return err
 	}
 
@@ -72,11 +162,11 @@ func writeTarContents(out *tar.Writer, c *chart.Chart, prefix string) error {
 	// TODO: remove the APIVersion check when APIVersionV1 is not used anymore
 	if c.Metadata.APIVersion == chart.APIVersionV2 {
 		if c.Lock != nil {
-			ldata, err := yaml.Marshal(c.Lock)
+			ldata, err := w.marshal(c.Lock)
 			if err != nil {
 				return err
 			}
-			if err := writeToTar(out, filepath.Join(base, "Chart.lock"), ldata); err != nil {
+			if err := w.writeToTar(filepath.Join(base, "Chart.lock"), ldata); err != nil {
 				return err
 			}
 		}
@@ -85,7 +175,7 @@ func writeTarContents(out *tar.Writer, c *chart.Chart, prefix string) error {
 	// Save values.yaml
 	for _, f := range c.Raw {
 		if f.Name == chartutil.ValuesfileName {
-			if err := writeToTar(out, filepath.Join(base, chartutil.ValuesfileName), f.Data); err != nil {
+			if err := w.writeToTar(filepath.Join(base, chartutil.ValuesfileName), f.Data); err != nil {
 				return err
 			}
 		}
@@ -96,48 +186,91 @@ func writeTarContents(out *tar.Writer, c *chart.Chart, prefix string) error {
 		if !json.Valid(c.Schema) {
 			return errors.New("Invalid JSON in " + chartutil.SchemafileName)
 		}
-		if err := writeToTar(out, filepath.Join(base, chartutil.SchemafileName), c.Schema); err != nil {
+		if err := w.writeToTar(filepath.Join(base, chartutil.SchemafileName), c.Schema); err != nil {
 			return err
 		}
 	}
 
 	// Save templates
-	for _, f := range c.Templates {
+	for _, f := range w.sortedFiles(c.Templates) {
 		n := filepath.Join(base, f.Name)
-		if err := writeToTar(out, n, f.Data); err != nil {
+		if err := w.writeToTar(n, f.Data); err != nil {
 			return err
 		}
 	}
 
 	// Save files
-	for _, f := range c.Files {
+	for _, f := range w.sortedFiles(c.Files) {
 		n := filepath.Join(base, f.Name)
-		if err := writeToTar(out, n, f.Data); err != nil {
+		if err := w.writeToTar(n, f.Data); err != nil {
 			return err
 		}
 	}
 
 	// Save dependencies
-	for _, dep := range c.Dependencies() {
-		if err := writeTarContents(out, dep, filepath.Join(base, chartutil.ChartsDir)); err != nil {
+	for _, dep := range w.sortedCharts(c.Dependencies()) {
+		if err := w.writeTarContents(dep, filepath.Join(base, chartutil.ChartsDir)); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-// writeToTar writes a single file to a tar archive.
-func writeToTar(out *tar.Writer, name string, body []byte) error {
-	// TODO: Do we need to create dummy parent directory names if none exist?
+// sortedFiles returns files sorted by name in Reproducible mode, and as they are otherwise.
+func (w *archiveWriter) sortedFiles(files []*chart.File) []*chart.File {
+	if w.mode != Reproducible {
+		return files
+	}
+	sorted := append([]*chart.File{}, files...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	return sorted
+}
+
+// sortedCharts returns charts sorted by name in Reproducible mode, and as they are otherwise.
+func (w *archiveWriter) sortedCharts(charts []*chart.Chart) []*chart.Chart {
+	if w.mode != Reproducible {
+		return charts
+	}
+	sorted := append([]*chart.Chart{}, charts...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Name() < sorted[j].Name() })
+	return sorted
+}
+
+// writeToTar writes a single file to a tar archive. In Reproducible mode, entries for the
+// parent directories are written first if they have not been written yet.
+func (w *archiveWriter) writeToTar(name string, body []byte) error {
+	name = filepath.ToSlash(name)
+	modTime := time.Now()
+	if w.mode == Reproducible {
+		modTime = ReproducibleModTime
+		if err := w.writeDir(path.Dir(name)); err != nil {
+			return err
+		}
+	}
+
 	h := &tar.Header{
-		Name:    filepath.ToSlash(name),
+		Name:    name,
 		Mode:    0644,
 		Size:    int64(len(body)),
-		ModTime: time.Now(),
+		ModTime: modTime,
 	}
-	if err := out.WriteHeader(h); err != nil {
+	return w.emit(h, body)
+}
+
+// writeDir writes an entry for dir, and for each of its parents, unless it has already been written.
+func (w *archiveWriter) writeDir(dir string) error {
+	if dir == "." || dir == "/" || w.dirs[dir] {
+		return nil
+	}
+	if err := w.writeDir(path.Dir(dir)); err != nil {
 		return err
 	}
-	_, err := out.Write(body)
-	return err
+
+	w.dirs[dir] = true
+	return w.emit(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     dir + "/",
+		Mode:     0755,
+		ModTime:  ReproducibleModTime,
+	}, nil)
 }
@@ -0,0 +1,236 @@
+package helm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+var modes = []Mode{Default, Compatible, Reproducible}
+
+// chartShapes are the charts that archives are tested with.
+var chartShapes = []struct {
+	name  string
+	chart func() *chart.Chart
+}{
+	{"basic", func() *chart.Chart { return testChart("basic", chart.APIVersionV2, 0) }},
+	{"legacy", func() *chart.Chart { return testChart("legacy", chart.APIVersionV1, 1) }},
+	{"subcharts", func() *chart.Chart { return testChart("nested", chart.APIVersionV2, 2) }},
+}
+
+// testChart returns a chart with templates, values, a schema, files large enough to be
+// compressed in advance by a Template, and depth levels of subcharts.
+func testChart(name, apiVersion string, depth int) *chart.Chart {
+	values := []byte(fmt.Sprintf("replicaCount: 1\nimage:\n  repository: %s\n  tag: \"\"\n", name))
+	c := &chart.Chart{
+		Metadata: &chart.Metadata{
+			APIVersion:  apiVersion,
+			Name:        name,
+			Version:     "0.1.0",
+			AppVersion:  "1.16.0",
+			Description: "A Helm chart for " + name,
+			Type:        "application",
+		},
+		Values: map[string]interface{}{"replicaCount": 1},
+		Raw:    []*chart.File{{Name: chartutil.ValuesfileName, Data: values}},
+		Schema: []byte(`{"type":"object","properties":{"replicaCount":{"type":"integer"}}}`),
+		Templates: []*chart.File{
+			{Name: "templates/service.yaml", Data: []byte("kind: Service\nmetadata:\n  name: {{ .Release.Name }}\n")},
+			{Name: "templates/_helpers.tpl", Data: []byte(`{{- define "name" -}}{{ .Chart.Name }}{{- end }}` + "\n")},
+			{Name: "templates/deployment.yaml", Data: []byte(strings.Repeat("# padding of the deployment\n", 300))},
+		},
+		Files: []*chart.File{
+			{Name: "files/large", Data: bytes.Repeat([]byte("0123456789abcdef"), 1<<10)},
+			{Name: "README.md", Data: []byte("# " + name + "\n")},
+		},
+	}
+	if depth == 0 {
+		return c
+	}
+
+	sub := testChart(name+"-sub", apiVersion, depth-1)
+	dep := &chart.Dependency{Name: sub.Name(), Version: sub.Metadata.Version, Repository: "https://charts.example.com"}
+	c.Metadata.Dependencies = []*chart.Dependency{dep}
+	if apiVersion == chart.APIVersionV1 {
+		c.Files = append(c.Files, &chart.File{
+			Name: "requirements.yaml",
+			Data: []byte(fmt.Sprintf("dependencies:\n- name: %s\n  repository: %s\n  version: %s\n", dep.Name, dep.Repository, dep.Version)),
+		})
+	} else {
+		c.Lock = &chart.Lock{Digest: "sha256:0123", Dependencies: []*chart.Dependency{dep}}
+	}
+	c.SetDependencies(sub)
+	return c
+}
+
+// tarEntries decompresses the archive data and returns its entries, with their content.
+func tarEntries(t testing.TB, data []byte) ([]*tar.Header, [][]byte) {
+	t.Helper()
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(zr)
+
+	var headers []*tar.Header
+	var bodies [][]byte
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return headers, bodies
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		headers = append(headers, h)
+		bodies = append(bodies, body)
+	}
+}
+
+// layout describes the entries of an archive, without their modification times.
+func layout(t testing.TB, data []byte) []string {
+	t.Helper()
+	headers, bodies := tarEntries(t, data)
+	entries := make([]string, len(headers))
+	for i, h := range headers {
+		entries[i] = fmt.Sprintf("%c %s %o %d %x", h.Typeflag, h.Name, h.Mode, h.Size, bodies[i])
+	}
+	return entries
+}
+
+// checkLoaded checks that loaded has the content of c.
+func checkLoaded(t *testing.T, c, loaded *chart.Chart) {
+	t.Helper()
+	// Default mode writes empty fields, which are loaded as empty instead of nil slices and maps.
+	if got, want := jsonOf(t, loaded.Metadata), jsonOf(t, c.Metadata); got != want {
+		t.Errorf("%s: metadata is %s, want %s", c.Name(), got, want)
+	}
+	if got, want := jsonOf(t, loaded.Lock), jsonOf(t, c.Lock); got != want {
+		t.Errorf("%s: lock is %s, want %s", c.Name(), got, want)
+	}
+	if !bytes.Equal(loaded.Schema, c.Schema) {
+		t.Errorf("%s: schema is %s, want %s", c.Name(), loaded.Schema, c.Schema)
+	}
+	for _, f := range c.Raw {
+		if f.Name == chartutil.ValuesfileName && !reflect.DeepEqual(files(loaded.Raw)[f.Name], f.Data) {
+			t.Errorf("%s: values are %s, want %s", c.Name(), files(loaded.Raw)[f.Name], f.Data)
+		}
+	}
+	if !reflect.DeepEqual(files(loaded.Templates), files(c.Templates)) {
+		t.Errorf("%s: templates differ", c.Name())
+	}
+	if !reflect.DeepEqual(files(loaded.Files), files(c.Files)) {
+		t.Errorf("%s: files differ", c.Name())
+	}
+
+	deps, loadedDeps := c.Dependencies(), loaded.Dependencies()
+	sort.Slice(loadedDeps, func(i, j int) bool { return loadedDeps[i].Name() < loadedDeps[j].Name() })
+	if len(loadedDeps) != len(deps) {
+		t.Fatalf("%s: has %d subcharts, want %d", c.Name(), len(loadedDeps), len(deps))
+	}
+	for i := range deps {
+		checkLoaded(t, deps[i], loadedDeps[i])
+	}
+}
+
+func jsonOf(t *testing.T, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func files(fs []*chart.File) map[string][]byte {
+	m := make(map[string][]byte, len(fs))
+	for _, f := range fs {
+		m[f.Name] = f.Data
+	}
+	return m
+}
+
+func TestPackagerWriteLoads(t *testing.T) {
+	for _, mode := range modes {
+		for _, shape := range chartShapes {
+			t.Run(mode.String()+"/"+shape.name, func(t *testing.T) {
+				c := shape.chart()
+				buf, err := (&Packager{Mode: mode}).Package(c)
+				if err != nil {
+					t.Fatal(err)
+				}
+				loaded, err := loader.LoadArchive(buf)
+				if err != nil {
+					t.Fatalf("loading archive: %v", err)
+				}
+				checkLoaded(t, c, loaded)
+			})
+		}
+	}
+}
+
+func TestCompatibleMatchesSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "helm-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, shape := range chartShapes {
+		t.Run(shape.name, func(t *testing.T) {
+			c := shape.chart()
+			path, err := chartutil.Save(c, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			saved, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf, err := (&Packager{Mode: Compatible}).Package(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := layout(t, buf.Bytes()), layout(t, saved); !reflect.DeepEqual(got, want) {
+				t.Errorf("entries are\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+			}
+		})
+	}
+}
+
+func TestReproducibleIsIdentical(t *testing.T) {
+	for _, shape := range chartShapes {
+		t.Run(shape.name, func(t *testing.T) {
+			p := &Packager{Mode: Reproducible}
+			first, err := p.Package(shape.chart())
+			if err != nil {
+				t.Fatal(err)
+			}
+			second, err := p.Package(shape.chart())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(first.Bytes(), second.Bytes()) {
+				t.Error("archives of the same chart differ")
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package helm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+const (
+	blockSize = 512
+	// minSegmentSize is the size from which entries are compressed in advance. Smaller entries are
+	// compressed with the rest of each archive, since every segment restarts compression and adds
+	// a few bytes of framing, which would make archives of many small files noticeably larger.
+	minSegmentSize = 4 << 10
+)
+
+var (
+	// gzipHeader is the header that Package writes: no modification time, the Extra and Comment
+	// fields, and the default compression level.
+	gzipHeader = func() []byte {
+		const flagExtra, flagComment = 1 << 2, 1 << 4
+		h := []byte{0x1f, 0x8b, 8, flagExtra | flagComment, 0, 0, 0, 0, 0, 255}
+		h = append(h, byte(len(headerBytes)), byte(len(headerBytes)>>8))
+		h = append(h, headerBytes...)
+		return append(h, "Helm\x00"...)
+	}()
+
+	// tarTrailer marks the end of a tar archive.
+	tarTrailer = make([]byte, 2*blockSize)
+)
+
+// Template packages charts that have all the content of a template chart, except for their
+// Chart.yaml. Every other entry of the template chart is compressed once, when the Template is
+// created, and copied into each archive as it is.
+//
+// Archives have the same entries as those written by the Packager that created the Template,
+// in the same order, but are compressed in independent segments, so they are not byte-for-byte
+// identical to them. A Template can be used by multiple go-routines.
+type Template struct {
+	mode    Mode
+	entries []templateEntry
+	// flaters are flate.Writers that are reset for every segment.
+	flaters sync.Pool
+}
+
+// templateEntry is an entry of the template chart, with its name relative to the chart directory.
+type templateEntry struct {
+	header *tar.Header
+	// raw is the content of the entry, padded to the tar block size, and body is the same content
+	// compressed, if it is large enough to be compressed in advance. Both are empty for directories,
+	// empty files and the Chart.yaml of the template chart, which is marked by metadata.
+	body     []byte
+	raw      []byte
+	metadata bool
+}
+
+// Template pre-packages c, so that charts that only differ from c in their Chart.yaml can be
+// packaged without compressing the rest of their content again.
+func (p *Packager) Template(c *chart.Chart) (*Template, error) {
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("chart validation: %w", err)
+	}
+
+	t := &Template{mode: p.Mode}
+	t.flaters.New = func() interface{} {
+		// flate.NewWriter only fails for invalid levels.
+		fw, _ := flate.NewWriter(nil, flate.DefaultCompression)
+		return fw
+	}
+
+	base := c.Name() + "/"
+	w := newArchiveWriter(p.Mode, func(h *tar.Header, body []byte) error {
+		e := templateEntry{header: h}
+		h.Name = strings.TrimPrefix(h.Name, base)
+		if h.Name == chartutil.ChartfileName {
+			e.metadata = true
+		} else if len(body) > 0 {
+			e.raw = make([]byte, len(body)+padding(len(body)))
+			copy(e.raw, body)
+			if len(e.raw) >= minSegmentSize {
+				e.body = t.deflate(e.raw)
+			}
+		}
+		t.entries = append(t.entries, e)
+		return nil
+	})
+	if err := w.writeTarContents(c, ""); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// deflate compresses raw into a segment that can be copied into the middle of a deflate stream.
+func (t *Template) deflate(raw []byte) []byte {
+	buf := &bytes.Buffer{}
+	fw := t.flaters.Get().(*flate.Writer)
+	defer t.flaters.Put(fw)
+
+	fw.Reset(buf)
+	// Writes to a bytes.Buffer do not fail.
+	fw.Write(raw)
+	fw.Flush()
+	return buf.Bytes()
+}
+
+// Write writes an archive of the template chart with the metadata of c to out. Apart from
+// the metadata, c is expected to be the same as the template chart.
+func (t *Template) Write(out io.Writer, c *chart.Chart) error {
+	if err := c.Validate(); err != nil {
+		return fmt.Errorf("chart validation: %w", err)
+	}
+	w := newArchiveWriter(t.mode, nil)
+	cdata, err := w.marshalMetadata(c.Metadata)
+	if err != nil {
+		return err
+	}
+
+	modTime := time.Now()
+	if t.mode == Reproducible {
+		modTime = ReproducibleModTime
+	}
+
+	fw := t.flaters.Get().(*flate.Writer)
+	defer t.flaters.Put(fw)
+	fw.Reset(out)
+
+	crc := crc32.NewIEEE()
+	var size uint32
+	// compress writes raw to the current segment of the deflate stream.
+	compress := func(raw []byte) error {
+		crc.Write(raw)
+		size += uint32(len(raw))
+		_, err := fw.Write(raw)
+		return err
+	}
+
+	if _, err := out.Write(gzipHeader); err != nil {
+		return err
+	}
+	for _, e := range t.entries {
+		h := *e.header
+		h.Name = path.Join(c.Name(), h.Name)
+		if h.Typeflag == tar.TypeDir {
+			h.Name += "/"
+		}
+		h.ModTime = modTime
+		if e.metadata {
+			h.Size = int64(len(cdata))
+		}
+
+		hdr := &bytes.Buffer{}
+		if err := tar.NewWriter(hdr).WriteHeader(&h); err != nil {
+			return err
+		}
+		if err := compress(hdr.Bytes()); err != nil {
+			return err
+		}
+
+		if e.metadata {
+			if err := compress(append(cdata, make([]byte, padding(len(cdata)))...)); err != nil {
+				return err
+			}
+		}
+		if e.body == nil && e.raw != nil {
+			if err := compress(e.raw); err != nil {
+				return err
+			}
+		}
+		if e.body != nil {
+			// Align the stream to a byte boundary, copy in the pre-compressed segment,
+			// and start a new segment that does not refer back to the ones before it.
+			if err := fw.Flush(); err != nil {
+				return err
+			}
+			if _, err := out.Write(e.body); err != nil {
+				return err
+			}
+			crc.Write(e.raw)
+			size += uint32(len(e.raw))
+			fw.Reset(out)
+		}
+	}
+	if err := compress(tarTrailer); err != nil {
+		return err
+	}
+	if err := fw.Close(); err != nil {
+		return err
+	}
+
+	trailer := make([]byte, 8)
+	binary.LittleEndian.PutUint32(trailer[:4], crc.Sum32())
+	binary.LittleEndian.PutUint32(trailer[4:], size)
+	_, err = out.Write(trailer)
+	return err
+}
+
+// padding returns the number of bytes that pad n bytes to the tar block size.
+func padding(n int) int {
+	return -n & (blockSize - 1)
+}
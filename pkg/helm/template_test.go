@@ -0,0 +1,106 @@
+package helm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+// withMetadata returns a copy of c with a different name and version, like the charts that are
+// packaged with a Template of c.
+func withMetadata(c *chart.Chart, name, version string) *chart.Chart {
+	md := *c.Metadata
+	md.Name = name
+	md.Version = version
+	copied := *c
+	copied.Metadata = &md
+	return &copied
+}
+
+func decompress(t testing.TB, data []byte) []byte {
+	t.Helper()
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestTemplateMatchesPackager(t *testing.T) {
+	for _, mode := range modes {
+		for _, shape := range chartShapes {
+			t.Run(mode.String()+"/"+shape.name, func(t *testing.T) {
+				p := &Packager{Mode: mode}
+				tmpl, err := p.Template(shape.chart())
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				c := withMetadata(shape.chart(), "renamed", "1.2.3-rc.1")
+				got := &bytes.Buffer{}
+				if err := tmpl.Write(got, c); err != nil {
+					t.Fatal(err)
+				}
+				want, err := p.Package(c)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// Entries are only stamped with the same time in Reproducible mode, so the tar streams of
+				// other modes are compared without their modification times.
+				if mode == Reproducible {
+					if !bytes.Equal(decompress(t, got.Bytes()), decompress(t, want.Bytes())) {
+						t.Error("tar stream differs from that of the Packager")
+					}
+				} else if len(decompress(t, got.Bytes())) != len(decompress(t, want.Bytes())) {
+					t.Error("tar stream has a different length from that of the Packager")
+				}
+				if gl, wl := layout(t, got.Bytes()), layout(t, want.Bytes()); !reflect.DeepEqual(gl, wl) {
+					t.Errorf("entries are\n%v\nwant\n%v", gl, wl)
+				}
+
+				loaded, err := loader.LoadArchive(got)
+				if err != nil {
+					t.Fatalf("loading archive: %v", err)
+				}
+				checkLoaded(t, c, loaded)
+			})
+		}
+	}
+}
+
+func BenchmarkPackagerWrite(b *testing.B) {
+	c := testChart("bench", chart.APIVersionV2, 2)
+	p := &Packager{Mode: Compatible}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := p.Write(ioutil.Discard, c); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTemplateWrite(b *testing.B) {
+	c := testChart("bench", chart.APIVersionV2, 2)
+	tmpl, err := (&Packager{Mode: Compatible}).Template(c)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := tmpl.Write(ioutil.Discard, c); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+package random
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Distribution samples non-negative integers.
+type Distribution interface {
+	Sample(r *rand.Rand) int64
+	String() string
+}
+
+// ParseDistribution returns the distribution described by s, which is one of:
+//
+//	fixed:<n>
+//	uniform:<min>:<max>
+//	lognormal:<median>:<sigma>
+//	zipf:<exponent>:<max>
+//	histogram:<file>
+//
+// Integers may have a binary unit suffix such as K, Mi or GiB.
+func ParseDistribution(s string) (Distribution, error) {
+	parts := strings.Split(s, ":")
+	args := parts[1:]
+	want := map[string]int{"fixed": 1, "uniform": 2, "lognormal": 2, "zipf": 2, "histogram": 1}
+	if n, ok := want[parts[0]]; !ok {
+		return nil, fmt.Errorf("unknown distribution %q", parts[0])
+	} else if len(args) != n {
+		return nil, fmt.Errorf("distribution %q needs %d argument(s), got %d", parts[0], n, len(args))
+	}
+
+	switch parts[0] {
+	case "fixed":
+		n, err := ParseInt(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return Fixed(n), nil
+	case "uniform":
+		min, err := ParseInt(args[0])
+		if err != nil {
+			return nil, err
+		}
+		max, err := ParseInt(args[1])
+		if err != nil {
+			return nil, err
+		}
+		return NewUniform(min, max)
+	case "lognormal":
+		median, err := ParseInt(args[0])
+		if err != nil {
+			return nil, err
+		}
+		sigma, err := strconv.ParseFloat(args[1], 64)
+		if err != nil {
+			return nil, err
+		}
+		return NewLogNormal(median, sigma)
+	case "zipf":
+		exponent, err := strconv.ParseFloat(args[0], 64)
+		if err != nil {
+			return nil, err
+		}
+		max, err := ParseInt(args[1])
+		if err != nil {
+			return nil, err
+		}
+		return NewZipf(exponent, max)
+	default:
+		return LoadHistogram(args[0])
+	}
+}
+
+// ParseInt parses a non-negative integer with an optional binary unit suffix, e.g. "512", "64K" or "2MiB".
+func ParseInt(s string) (int64, error) {
+	num := strings.TrimSuffix(strings.TrimSuffix(s, "B"), "i")
+	mult := int64(1)
+	if l := len(num); l > 0 {
+		if i := strings.IndexByte("KMG", num[l-1]); i >= 0 {
+			mult = 1 << (10 * uint(i+1))
+			num = num[:l-1]
+		}
+	}
+
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid integer %q", s)
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("integer %q cannot be negative", s)
+	}
+	if n > math.MaxInt64/mult {
+		return 0, fmt.Errorf("integer %q is too large", s)
+	}
+	return n * mult, nil
+}
+
+// Fixed always samples the same value.
+type Fixed int64
+
+func (f Fixed) Sample(*rand.Rand) int64 {
+	return int64(f)
+}
+
+func (f Fixed) String() string {
+	return fmt.Sprintf("fixed %d", int64(f))
+}
+
+// Uniform samples values between Min and Max, both inclusive, with equal probability.
+type Uniform struct {
+	Min, Max int64
+}
+
+func NewUniform(min, max int64) (*Uniform, error) {
+	if min < 0 || max < min {
+		return nil, fmt.Errorf("uniform range [%d, %d] is invalid", min, max)
+	}
+	return &Uniform{Min: min, Max: max}, nil
+}
+
+func (u *Uniform) Sample(r *rand.Rand) int64 {
+	return r.Int63n(u.Max-u.Min+1) + u.Min
+}
+
+func (u *Uniform) String() string {
+	return fmt.Sprintf("uniform between %d and %d", u.Min, u.Max)
+}
+
+// LogNormal samples values whose logarithm is normally distributed around the log of Median.
+// Sigma controls the skew, with most real-world sizes having a sigma between 0.5 and 2.
+type LogNormal struct {
+	Median int64
+	Sigma  float64
+}
+
+func NewLogNormal(median int64, sigma float64) (*LogNormal, error) {
+	if median <= 0 || sigma < 0 {
+		return nil, fmt.Errorf("log-normal median %d and sigma %v must be positive", median, sigma)
+	}
+	return &LogNormal{Median: median, Sigma: sigma}, nil
+}
+
+func (l *LogNormal) Sample(r *rand.Rand) int64 {
+	v := math.Exp(math.Log(float64(l.Median)) + l.Sigma*r.NormFloat64())
+	if v >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(v)
+}
+
+func (l *LogNormal) String() string {
+	return fmt.Sprintf("log-normal with median %d and sigma %v", l.Median, l.Sigma)
+}
+
+// Zipf samples values between 1 and Max following a power law, where the probability of
+// sampling k is proportional to 1/k^Exponent. Most samples are small but a few are very large.
+//
+// Values are sampled by rejection-inversion (Hörmann and Derflinger, 1996), which needs no table
+// of Max probabilities, so Max can be as large as sizes get.
+type Zipf struct {
+	Exponent float64
+	Max      int64
+	// hMin and hMax bound the integral of the hat function that values are sampled under, and
+	// squeeze accepts values close to the sampled point without evaluating the integral.
+	hMin, hMax, squeeze float64
+}
+
+func NewZipf(exponent float64, max int64) (*Zipf, error) {
+	if exponent <= 0 || max < 1 {
+		return nil, fmt.Errorf("zipf exponent %v and max %d must be positive", exponent, max)
+	}
+
+	z := &Zipf{Exponent: exponent, Max: max}
+	z.hMin = z.hIntegral(1.5) - 1
+	z.hMax = z.hIntegral(float64(max) + 0.5)
+	z.squeeze = 2 - z.hIntegralInverse(z.hIntegral(2.5)-z.h(2))
+	return z, nil
+}
+
+func (z *Zipf) Sample(r *rand.Rand) int64 {
+	for {
+		u := z.hMax + r.Float64()*(z.hMin-z.hMax)
+		x := z.hIntegralInverse(u)
+		// x is compared before it is converted, since it may not fit in an int64.
+		k := z.Max
+		if x+0.5 < float64(z.Max) {
+			k = int64(x + 0.5)
+		}
+		if k < 1 {
+			k = 1
+		}
+		if float64(k)-x <= z.squeeze || u >= z.hIntegral(float64(k)+0.5)-z.h(float64(k)) {
+			return k
+		}
+	}
+}
+
+// h is the probability of sampling x, up to a constant factor.
+func (z *Zipf) h(x float64) float64 {
+	return math.Exp(-z.Exponent * math.Log(x))
+}
+
+// hIntegral is the integral of h, up to a constant, which is log(x) for an exponent of 1.
+func (z *Zipf) hIntegral(x float64) float64 {
+	logX := math.Log(x)
+	return expm1Ratio((1-z.Exponent)*logX) * logX
+}
+
+// hIntegralInverse is the inverse of hIntegral.
+func (z *Zipf) hIntegralInverse(x float64) float64 {
+	t := x * (1 - z.Exponent)
+	if t < -1 {
+		// Rounding errors can take t just below its lower bound.
+		t = -1
+	}
+	return math.Exp(log1pRatio(t) * x)
+}
+
+// expm1Ratio returns (e^x-1)/x, which is 1 for x 0.
+func expm1Ratio(x float64) float64 {
+	if math.Abs(x) > 1e-8 {
+		return math.Expm1(x) / x
+	}
+	return 1 + x*0.5*(1+x/3*(1+0.25*x))
+}
+
+// log1pRatio returns log(1+x)/x, which is 1 for x 0.
+func log1pRatio(x float64) float64 {
+	if math.Abs(x) > 1e-8 {
+		return math.Log1p(x) / x
+	}
+	return 1 - x*(0.5-x*(1.0/3-0.25*x))
+}
+
+func (z *Zipf) String() string {
+	return fmt.Sprintf("zipf with exponent %v up to %d", z.Exponent, z.Max)
+}
+
+// Bucket is a range of values in a Histogram. Values within the bucket are sampled uniformly.
+type Bucket struct {
+	Min, Max int64
+	Weight   float64
+}
+
+// Histogram samples values from empirically weighted buckets.
+type Histogram struct {
+	buckets []Bucket
+	// cumulative has the running total of the bucket weights.
+	cumulative []float64
+}
+
+func NewHistogram(buckets []Bucket) (*Histogram, error) {
+	if len(buckets) == 0 {
+		return nil, fmt.Errorf("histogram has no buckets")
+	}
+
+	h := &Histogram{buckets: buckets, cumulative: make([]float64, len(buckets))}
+	var total float64
+	for i, b := range buckets {
+		if b.Min < 0 || b.Max < b.Min || b.Weight < 0 {
+			return nil, fmt.Errorf("histogram bucket %d is invalid", i+1)
+		}
+		total += b.Weight
+		h.cumulative[i] = total
+	}
+	if total <= 0 {
+		return nil, fmt.Errorf("histogram buckets have no weight")
+	}
+	return h, nil
+}
+
+// LoadHistogram reads a histogram from a file.
+func LoadHistogram(path string) (*Histogram, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h, err := ReadHistogram(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return h, nil
+}
+
+// ReadHistogram reads a histogram that has one bucket per line in the form `<value> <weight>`
+// or `<min>-<max> <weight>`. Empty lines and lines starting with # are ignored.
+func ReadHistogram(r io.Reader) (*Histogram, error) {
+	var buckets []Bucket
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected a value and a weight", line)
+		}
+
+		var (
+			b   Bucket
+			err error
+		)
+		bounds := strings.SplitN(fields[0], "-", 2)
+		if b.Min, err = ParseInt(bounds[0]); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		b.Max = b.Min
+		if len(bounds) == 2 {
+			if b.Max, err = ParseInt(bounds[1]); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+		if b.Weight, err = strconv.ParseFloat(fields[1], 64); err != nil {
+			return nil, fmt.Errorf("line %d: invalid weight %q", line, fields[1])
+		}
+		buckets = append(buckets, b)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return NewHistogram(buckets)
+}
+
+func (h *Histogram) Sample(r *rand.Rand) int64 {
+	w := r.Float64() * h.cumulative[len(h.cumulative)-1]
+	b := h.buckets[sort.SearchFloat64s(h.cumulative, w)]
+	return r.Int63n(b.Max-b.Min+1) + b.Min
+}
+
+func (h *Histogram) String() string {
+	return fmt.Sprintf("histogram with %d buckets", len(h.buckets))
+}
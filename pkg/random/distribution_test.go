@@ -0,0 +1,215 @@
+package random
+
+import (
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseInt(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int64
+		err  string
+	}{
+		{s: "0", want: 0},
+		{s: "512", want: 512},
+		{s: "512B", want: 512},
+		{s: "64K", want: 64 << 10},
+		{s: "64Ki", want: 64 << 10},
+		{s: "64KiB", want: 64 << 10},
+		{s: "2M", want: 2 << 20},
+		{s: "2MiB", want: 2 << 20},
+		{s: "3G", want: 3 << 30},
+		{s: "3GiB", want: 3 << 30},
+		{s: "9223372036854775807", want: math.MaxInt64},
+		{s: "8589934591G", want: 8589934591 << 30},
+		{s: "8589934592G", err: "too large"},
+		{s: "9007199254740992M", err: "too large"},
+		{s: "9223372036854775808", err: "invalid"},
+		{s: "-1", err: "negative"},
+		{s: "-1K", err: "negative"},
+		{s: "", err: "invalid"},
+		{s: "K", err: "invalid"},
+		{s: "1T", err: "invalid"},
+		{s: "1.5M", err: "invalid"},
+		{s: "1 M", err: "invalid"},
+	}
+	for _, tt := range tests {
+		got, err := ParseInt(tt.s)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ParseInt(%q) = %d, %v, want an error with %q", tt.s, got, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseInt(%q) = %d, %v, want %d", tt.s, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseDistribution(t *testing.T) {
+	dir, err := ioutil.TempDir("", "distribution-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	histogram := filepath.Join(dir, "sizes")
+	if err := ioutil.WriteFile(histogram, []byte("# sizes\n1K 3\n\n4K-1M 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		s    string
+		want string
+		err  string
+	}{
+		{s: "fixed:1M", want: "fixed 1048576"},
+		{s: "uniform:1:10", want: "uniform between 1 and 10"},
+		{s: "uniform:3:3", want: "uniform between 3 and 3"},
+		{s: "lognormal:64K:1.5", want: "log-normal with median 65536 and sigma 1.5"},
+		{s: "zipf:1.2:100", want: "zipf with exponent 1.2 up to 100"},
+		{s: "zipf:0.5:1G", want: "zipf with exponent 0.5 up to 1073741824"},
+		{s: "histogram:" + histogram, want: "histogram with 2 buckets"},
+		{s: "", err: "unknown distribution"},
+		{s: "normal:1:2", err: "unknown distribution"},
+		{s: "Fixed:1", err: "unknown distribution"},
+		{s: "fixed", err: "needs 1 argument(s), got 0"},
+		{s: "fixed:1:2", err: "needs 1 argument(s), got 2"},
+		{s: "uniform:1", err: "needs 2 argument(s), got 1"},
+		{s: "fixed:x", err: "invalid integer"},
+		{s: "fixed:-1", err: "negative"},
+		{s: "uniform:10:1", err: "invalid"},
+		{s: "uniform:1:x", err: "invalid integer"},
+		{s: "lognormal:0:1", err: "must be positive"},
+		{s: "lognormal:1K:-1", err: "must be positive"},
+		{s: "lognormal:1K:x", err: "invalid syntax"},
+		{s: "zipf:0:100", err: "must be positive"},
+		{s: "zipf:1:0", err: "must be positive"},
+		{s: "zipf:x:100", err: "invalid syntax"},
+		{s: "histogram:" + filepath.Join(dir, "missing"), err: "no such file"},
+	}
+	for _, tt := range tests {
+		d, err := ParseDistribution(tt.s)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ParseDistribution(%q) = %v, %v, want an error with %q", tt.s, d, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || d.String() != tt.want {
+			t.Errorf("ParseDistribution(%q) = %v, %v, want %s", tt.s, d, err, tt.want)
+		}
+	}
+}
+
+func TestReadHistogram(t *testing.T) {
+	tests := []struct {
+		s   string
+		err string
+	}{
+		{s: "", err: "no buckets"},
+		{s: "# only a comment\n", err: "no buckets"},
+		{s: "1K\n", err: "line 1: expected a value and a weight"},
+		{s: "1K 1\nx 1\n", err: "line 2: invalid integer"},
+		{s: "1K 1\n1K-x 1\n", err: "line 2: invalid integer"},
+		{s: "1K x\n", err: "line 1: invalid weight"},
+		{s: "2K-1K 1\n", err: "bucket 1 is invalid"},
+		{s: "1K -1\n", err: "bucket 1 is invalid"},
+		{s: "1K 0\n2K 0\n", err: "no weight"},
+	}
+	for _, tt := range tests {
+		if _, err := ReadHistogram(strings.NewReader(tt.s)); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("ReadHistogram(%q) returned %v, want an error with %q", tt.s, err, tt.err)
+		}
+	}
+}
+
+func TestZipfSample(t *testing.T) {
+	const samples = 100000
+	r := rand.New(rand.NewSource(1))
+	for _, exponent := range []float64{0.5, 1, 1.5, 3} {
+		for _, max := range []int64{1, 2, 10} {
+			z, err := NewZipf(exponent, max)
+			if err != nil {
+				t.Fatal(err)
+			}
+			counts := make([]int, max+1)
+			for i := 0; i < samples; i++ {
+				k := z.Sample(r)
+				if k < 1 || k > max {
+					t.Fatalf("%v sampled %d", z, k)
+				}
+				counts[k]++
+			}
+
+			var total float64
+			for k := int64(1); k <= max; k++ {
+				total += 1 / math.Pow(float64(k), exponent)
+			}
+			for k := int64(1); k <= max; k++ {
+				want := 1 / math.Pow(float64(k), exponent) / total
+				if got := float64(counts[k]) / samples; math.Abs(got-want) > 0.01 {
+					t.Errorf("%v sampled %d with a probability of %.3f, want %.3f", z, k, got, want)
+				}
+			}
+		}
+	}
+
+	// Values up to a large max are sampled without a table of their probabilities.
+	z, err := NewZipf(1.1, math.MaxInt64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var large int
+	for i := 0; i < samples; i++ {
+		k := z.Sample(r)
+		if k < 1 {
+			t.Fatalf("%v sampled %d", z, k)
+		}
+		if k > 1<<20 {
+			large++
+		}
+	}
+	if large == 0 {
+		t.Errorf("%v sampled no values above %d", z, 1<<20)
+	}
+}
+
+func TestHistogramSample(t *testing.T) {
+	h, err := NewHistogram([]Bucket{{Min: 10, Max: 10, Weight: 1}, {Min: 100, Max: 200, Weight: 0}, {Min: 1000, Max: 1999, Weight: 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const samples = 100000
+	r := rand.New(rand.NewSource(1))
+	var small, low, high int
+	for i := 0; i < samples; i++ {
+		switch v := h.Sample(r); {
+		case v == 10:
+			small++
+		case v >= 1000 && v < 1500:
+			low++
+		case v >= 1500 && v <= 1999:
+			high++
+		default:
+			t.Fatalf("%v sampled %d, which is in no bucket with weight", h, v)
+		}
+	}
+	// Buckets are sampled in proportion to their weight, and values within them uniformly.
+	for _, c := range []struct {
+		name  string
+		count int
+		want  float64
+	}{{"10", small, 0.25}, {"1000-1499", low, 0.375}, {"1500-1999", high, 0.375}} {
+		if got := float64(c.count) / samples; math.Abs(got-c.want) > 0.01 {
+			t.Errorf("%v sampled %s with a probability of %.3f, want %.3f", h, c.name, got, c.want)
+		}
+	}
+}
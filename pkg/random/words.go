@@ -0,0 +1,22 @@
+package random
+
+var (
+	// Adjectives and Nouns are short lowercase words that make plausible chart names when combined.
+	Adjectives = []string{
+		"agile", "amber", "ancient", "azure", "bold", "brave", "bright", "calm", "clever", "cosmic",
+		"crimson", "crisp", "daring", "dusty", "eager", "early", "electric", "emerald", "fancy", "fast",
+		"fierce", "fluffy", "frosty", "gentle", "giant", "golden", "happy", "hidden", "honest", "humble",
+		"icy", "jolly", "keen", "kind", "lazy", "little", "lively", "lucky", "lunar", "mellow",
+		"mighty", "misty", "modern", "noble", "orange", "patient", "polar", "proud", "quick", "quiet",
+		"rapid", "rusty", "shiny", "silent", "silver", "simple", "sleepy", "smooth", "solar", "steady",
+		"stormy", "sunny", "swift", "tidy", "tiny", "vivid", "wandering", "wild", "wise", "young",
+	}
+	Nouns = []string{
+		"api", "agent", "backend", "badger", "beacon", "broker", "cache", "cluster", "collector", "controller",
+		"crawler", "daemon", "dashboard", "db", "dispatcher", "exporter", "falcon", "feeder", "frontend", "gateway",
+		"harbor", "hawk", "indexer", "ingress", "keeper", "lemur", "listener", "lynx", "manager", "mesh",
+		"monitor", "operator", "otter", "panda", "pipeline", "portal", "proxy", "queue", "raven", "relay",
+		"registry", "router", "runner", "scheduler", "scraper", "server", "service", "sidecar", "sink", "store",
+		"stream", "tiger", "tracker", "vault", "viewer", "walrus", "watcher", "webhook", "worker", "zebra",
+	}
+)
@@ -0,0 +1,164 @@
+package pusher
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+// WithOriginalOrder pushes a directory of chart archives in the order they were last modified,
+// which for a backup of a repository is usually the order they were uploaded in, instead of by
+// name and version. If speedup is greater than 0, pushes are also spaced out like the original
+// uploads, speedup times faster. Otherwise, the archives are pushed one at a time by a single
+// go-routine, since routines that push different charts at once would not keep their order.
+// Corpora written by Generate are always pushed in the order they were generated.
+func WithOriginalOrder(speedup float64) Option {
+	return func(o *options) {
+		o.originalOrder = true
+		o.replaySpeedup = speedup
+	}
+}
+
+// invalidArchive is a file in a directory of chart archives that the Helm loader rejects.
+type invalidArchive struct {
+	file string
+	err  error
+}
+
+// scanArchives loads every .tgz file in dir and its subdirectories with the Helm loader, using
+// n go-routines. It returns the archives that load, and those that do not along with their error.
+func scanArchives(dir string, n int64) ([]corpusChart, []invalidArchive, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(path, ".tgz") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		charts  []corpusChart
+		invalid []invalidArchive
+	)
+	paths := make(chan string)
+	for i := int64(0); i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				c, err := loadArchive(dir, path)
+				mu.Lock()
+				if err != nil {
+					invalid = append(invalid, invalidArchive{file: c.File, err: err})
+				} else {
+					charts = append(charts, c)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, path := range files {
+		paths <- path
+	}
+	close(paths)
+	wg.Wait()
+
+	sort.Slice(invalid, func(i, j int) bool { return invalid[i].file < invalid[j].file })
+	return charts, invalid, nil
+}
+
+// loadArchive loads the chart archive at path, in dir, with the Helm loader.
+func loadArchive(dir, path string) (corpusChart, error) {
+	c := corpusChart{File: path}
+	if rel, err := filepath.Rel(dir, path); err == nil {
+		c.File = rel
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return c, err
+	}
+	c.modTime = info.ModTime()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	ch, err := loader.LoadArchive(bytes.NewReader(data))
+	if err != nil {
+		return c, err
+	}
+
+	c.Name = ch.Name()
+	c.Version = ch.Metadata.Version
+	c.Size = int64(len(data))
+	c.Digest = fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+	c.Legacy = ch.Metadata.APIVersion == chart.APIVersionV1
+	return c, nil
+}
+
+// sortArchives orders charts by name and version, or by modification time if originalOrder is set.
+// When speedup is greater than 0, each chart is scheduled at its original offset from the first one,
+// divided by speedup.
+func sortArchives(charts []corpusChart, originalOrder bool, speedup float64) {
+	byVersion := func(i, j int) bool {
+		if charts[i].Name != charts[j].Name {
+			return charts[i].Name < charts[j].Name
+		}
+		vi, erri := semver.NewVersion(charts[i].Version)
+		vj, errj := semver.NewVersion(charts[j].Version)
+		if erri != nil || errj != nil {
+			return charts[i].Version < charts[j].Version
+		}
+		return vi.LessThan(vj)
+	}
+
+	if !originalOrder {
+		sort.SliceStable(charts, byVersion)
+		return
+	}
+	sort.SliceStable(charts, func(i, j int) bool {
+		if !charts[i].modTime.Equal(charts[j].modTime) {
+			return charts[i].modTime.Before(charts[j].modTime)
+		}
+		return byVersion(i, j)
+	})
+
+	if speedup > 0 && len(charts) > 0 {
+		first := charts[0].modTime
+		for i := range charts {
+			charts[i].at = time.Duration(float64(charts[i].modTime.Sub(first)) / speedup)
+		}
+	}
+}
+
+// printInvalid writes the archives that are skipped because the Helm loader rejects them to w.
+func printInvalid(w io.Writer, invalid []invalidArchive) {
+	if len(invalid) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "* Skipping %d archives that the Helm loader rejects:\n", len(invalid))
+	for _, a := range invalid {
+		fmt.Fprintf(w, "\t%s: %s\n", a.file, a.err)
+	}
+}
@@ -0,0 +1,40 @@
+package pusher
+
+import (
+	"errors"
+	"io"
+
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+var (
+	errCacheSize = errors.New("the packaging cache cannot be used with package sizes")
+)
+
+// packager writes chart archives. It is either a helm.Packager or a helm.Template.
+type packager interface {
+	Write(w io.Writer, c *chart.Chart) error
+}
+
+// WithPackagingCache compresses the content of the template chart once, and only generates
+// Chart.yaml for every push. Archives have the same content as without the cache, but compress
+// slightly worse. It cannot be combined with package sizes, which add a different filler file to
+// every chart.
+func WithPackagingCache() Option {
+	return func(o *options) {
+		o.cache = true
+	}
+}
+
+// packagerFor returns the packager for the template chart, or for its legacy copy if legacy is set.
+// Charts that have been mutated are packaged without the cache.
+func (r *routine) packagerFor(legacy bool) packager {
+	switch {
+	case !r.opts.cache || r.history != nil:
+		return r.opts.packager
+	case legacy:
+		return r.legacyTemplate
+	default:
+		return r.template
+	}
+}
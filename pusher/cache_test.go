@@ -0,0 +1,82 @@
+package pusher
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+// collectingTarget keeps every chart pushed to it.
+type collectingTarget struct {
+	mu     sync.Mutex
+	charts map[string][]byte
+}
+
+func (t *collectingTarget) Push(_ Doer, name, version string, body io.Reader, _ int64) error {
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.charts == nil {
+		t.charts = map[string][]byte{}
+	}
+	t.charts[name+"-"+version] = data
+	return nil
+}
+
+func (t *collectingTarget) String() string {
+	return "collecting"
+}
+
+func TestPackagingCacheIsShared(t *testing.T) {
+	s := Structure{Templates: 2, Subcharts: 2, SubchartDepth: 2, Lock: true}
+	target := &collectingTarget{}
+	p := &Pusher{nCharts: 40, nRoutines: 4, opts: defaultOptions()}
+	for _, opt := range []Option{WithPackagingCache(), WithLegacyCharts(0.5), WithStructure(s), WithTarget(target)} {
+		opt(&p.opts)
+	}
+	routines, err := p.routinesFor(scaffold(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range routines {
+		if r.template == nil || r.legacyTemplate == nil || r.template != routines[0].template || r.legacyTemplate != routines[0].legacyTemplate {
+			t.Fatalf("routine %d has templates %p and %p, want %p and %p shared by all routines",
+				r.id, r.template, r.legacyTemplate, routines[0].template, routines[0].legacyTemplate)
+		}
+		if r.id > 0 && r.chart == routines[0].chart {
+			t.Fatalf("routine %d shares its chart with routine 0", r.id)
+		}
+	}
+
+	p.run(routines, false, false, func(r *routine) {
+		r.push(2)
+	})
+	for _, r := range routines {
+		if r.errors != 0 {
+			t.Errorf("routine %d had %d errors", r.id, r.errors)
+		}
+	}
+
+	// Charts have the structure of the template chart, whether they are legacy charts or not.
+	apiVersions := map[string]int{}
+	for name, data := range target.charts {
+		c, err := loader.LoadArchive(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		apiVersions[c.Metadata.APIVersion]++
+		checkStructure(t, s, c, s.SubchartDepth)
+	}
+	if len(target.charts) != 40 || apiVersions[chart.APIVersionV1] == 0 || apiVersions[chart.APIVersionV2] == 0 {
+		t.Errorf("%d charts pushed with apiVersions %v, want 40 of both", len(target.charts), apiVersions)
+	}
+}
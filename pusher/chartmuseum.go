@@ -0,0 +1,108 @@
+package pusher
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ChartMuseum pushes charts to a ChartMuseum compatible API, which takes chart archives POSTed
+// to URL, such as http://127.0.0.1:8080/api/charts.
+type ChartMuseum struct {
+	URL      string
+	Username string
+	Password string
+	// Force overwrites charts that already exist.
+	Force bool
+	// Tenants, if greater than 0, spreads charts across this many repositories of a ChartMuseum
+	// that serves them TenantDepth levels deep, such as under /api/org3/repo17/charts for a depth
+	// of 2. Tenant i gets a share of charts proportional to 1/(i+1)^TenantSkew.
+	Tenants     int
+	TenantDepth int
+	TenantSkew  float64
+
+	tenants tenants
+}
+
+// NewChartMuseum returns a ChartMuseum target for the API at u.
+func NewChartMuseum(u, username, password string) *ChartMuseum {
+	return &ChartMuseum{URL: u, Username: username, Password: password}
+}
+
+func (t *ChartMuseum) String() string {
+	if t.Tenants > 0 {
+		return fmt.Sprintf("%s, spread across %d tenants %d levels deep with a skew of %.2f", t.URL, t.Tenants, t.TenantDepth, t.TenantSkew)
+	}
+	return t.URL
+}
+
+func (t *ChartMuseum) Push(do Doer, name, _ string, body io.Reader, size int64) error {
+	if t.Tenants == 0 {
+		return t.push(do, t.URL, body, size)
+	}
+
+	// Streamed charts are counted as they are sent, since their size is unknown.
+	var counted *requestBody
+	if size < 0 {
+		counted = &requestBody{ReadCloser: ioutil.NopCloser(body)}
+		body = counted
+	}
+	i := t.tenant(name)
+	start := time.Now()
+	err := t.push(do, t.api(i), body, size)
+	if counted != nil {
+		size = atomic.LoadInt64(&counted.n)
+	}
+	t.tenants.record(i, size, time.Since(start), err)
+	return err
+}
+
+func (t *ChartMuseum) push(do Doer, u string, body io.Reader, size int64) error {
+	req, err := t.newRequest(http.MethodPost, u, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	if t.Force {
+		q := req.URL.Query()
+		q.Add("force", "")
+		req.URL.RawQuery = q.Encode()
+	}
+
+	return expect(do, req, http.StatusCreated)
+}
+
+// api returns the URL of the API of tenant i, which replaces the /charts path segment that URL
+// ends with.
+func (t *ChartMuseum) api(i int) string {
+	return strings.TrimSuffix(t.URL, "/charts") + "/" + t.tenantPath(i) + "/charts"
+}
+
+func (t *ChartMuseum) newRequest(method, u string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(t.Username, t.Password)
+	return req, nil
+}
+
+// expect sends req and returns an error unless it completes with the given status.
+func expect(do Doer, req *http.Request, status int) error {
+	resp, err := do.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != status {
+		return &statusError{code: resp.StatusCode}
+	}
+	return nil
+}
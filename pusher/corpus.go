@@ -0,0 +1,217 @@
+package pusher
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	manifestFile = "manifest.json"
+	// defaultCorpusRetries is how many times a chart from a corpus is pushed again when failures are
+	// repeated, unless WithCorpusRetries says otherwise.
+	defaultCorpusRetries = 3
+)
+
+var (
+	errCorpusHostile = errors.New("hostile charts cannot be generated, as they are only built when pushed")
+)
+
+// WithCorpusRetries pushes a chart from a corpus again up to n times when it fails and failures are
+// repeated. Unlike generated charts, which are replaced by new ones, the same chart is pushed
+// again, so a registry that always rejects it would be retried forever without a limit.
+func WithCorpusRetries(n int) Option {
+	return func(o *options) {
+		o.corpusRetries = n
+	}
+}
+
+// manifest describes a corpus of packaged charts that were generated to be pushed later.
+type manifest struct {
+	Generated time.Time `json:"generated"`
+	// Options describes how the charts were generated.
+	Options []string      `json:"options"`
+	Charts  []corpusChart `json:"charts"`
+}
+
+// corpusChart is a packaged chart in a corpus. The versions of each chart are listed in the
+// order they were generated, which is the order in which they are pushed.
+type corpusChart struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// File is the path of the package, relative to the corpus directory.
+	File   string `json:"file"`
+	Size   int64  `json:"size"`
+	Digest string `json:"digest"`
+	Legacy bool   `json:"legacy,omitempty"`
+
+	// modTime is when an archive that was not generated was last modified, and at is when
+	// it is pushed, relative to the start of the run, if pushes are paced.
+	modTime time.Time
+	at      time.Duration
+}
+
+// corpus collects the charts that routines write to a directory.
+type corpus struct {
+	dir string
+
+	mu     sync.Mutex
+	charts []corpusChart
+	// files has the names of the files that have been written to the directory, so that charts
+	// with the same name and version, which namers and versioners can generate, do not overwrite
+	// each other.
+	files map[string]bool
+}
+
+// reserveFile returns a file name for the package of the chart with the given name and version
+// that no other chart in the corpus has.
+func (c *corpus) reserveFile(name, version string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.files == nil {
+		c.files = map[string]bool{}
+	}
+	file := fmt.Sprintf("%s-%s.tgz", name, version)
+	for i := 2; c.files[file]; i++ {
+		file = fmt.Sprintf("%s-%s.%d.tgz", name, version, i)
+	}
+	c.files[file] = true
+	return file
+}
+
+// saveChart writes the package read from reader to the corpus directory, instead of pushing it.
+func (r *routine) saveChart(reader io.Reader, name, version string, legacy bool) error {
+	c := corpusChart{
+		Name:    name,
+		Version: version,
+		File:    r.corpus.reserveFile(name, version),
+		Legacy:  legacy,
+	}
+
+	err := func() error {
+		f, err := os.Create(filepath.Join(r.corpus.dir, c.File))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		h := sha256.New()
+		if c.Size, err = io.Copy(f, io.TeeReader(reader, h)); err != nil {
+			return err
+		}
+		c.Digest = "sha256:" + hex.EncodeToString(h.Sum(nil))
+		return f.Close()
+	}()
+	if s, ok := reader.(*chartStream); ok {
+		s.wait()
+		if s.err == nil {
+			r.stats.packageSizes.add(s.n)
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to save chart: %w", err)
+		r.recordError(err)
+		return err
+	}
+
+	r.corpus.mu.Lock()
+	r.corpus.charts = append(r.corpus.charts, c)
+	r.corpus.mu.Unlock()
+	return nil
+}
+
+// writeManifest writes the manifest of the charts in the corpus to its directory.
+func (c *corpus) writeManifest(options []string) error {
+	data, err := json.MarshalIndent(manifest{Generated: time.Now().UTC(), Options: options, Charts: c.charts}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(c.dir, manifestFile), data, 0644)
+}
+
+// readManifest reads the manifest of the corpus in dir.
+func readManifest(dir string) (*manifest, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		return nil, err
+	}
+
+	m := &manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", manifestFile, err)
+	}
+	return m, nil
+}
+
+// splitCorpus divides charts between n routines. All versions of a chart go to the same routine,
+// so that they are pushed in order.
+func splitCorpus(charts []corpusChart, n int64) [][]corpusChart {
+	routine := map[string]int64{}
+	split := make([][]corpusChart, n)
+	for _, c := range charts {
+		i, ok := routine[c.Name]
+		if !ok {
+			i = int64(len(routine)) % n
+			routine[c.Name] = i
+		}
+		split[i] = append(split[i], c)
+	}
+	return split
+}
+
+// pushCorpus pushes the packaged charts in dir. Charts that fail are pushed again, up to the
+// number of corpus retries, when failures are repeated.
+func (r *routine) pushCorpus(dir string, charts []corpusChart) {
+	start := time.Now()
+	versions := map[string]int64{}
+	var names []string
+	for _, c := range charts {
+		if _, ok := versions[c.Name]; !ok {
+			names = append(names, c.Name)
+			versions[c.Name] = 0
+			if c.Legacy {
+				r.stats.legacyCharts++
+			}
+		}
+
+		if c.at > 0 {
+			time.Sleep(time.Until(start.Add(c.at)))
+		}
+		r.stats.packageSizes.add(c.Size)
+		for i := 0; ; i++ {
+			err := r.pushFile(dir, c)
+			atomic.AddInt64(&r.completed, 1)
+			if err == nil {
+				versions[c.Name]++
+				break
+			}
+			if !r.repeatFailures || i >= r.opts.corpusRetries {
+				break
+			}
+		}
+	}
+
+	for _, name := range names {
+		r.stats.versionsPerChart.add(versions[name])
+	}
+}
+
+func (r *routine) pushFile(dir string, c corpusChart) error {
+	f, err := os.Open(filepath.Join(dir, c.File))
+	if err != nil {
+		r.recordError(err)
+		return err
+	}
+	defer f.Close()
+
+	return r.pushChart(f, c.Size, c.Name, c.Version)
+}
@@ -0,0 +1,74 @@
+package pusher
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSaveChartKeepsDuplicates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pusher-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r := newTestRoutine(t, scaffold(t), 1)
+	r.corpus = &corpus{dir: dir}
+	for _, body := range []string{"first", "second"} {
+		if err := r.saveChart(strings.NewReader(body), "chart", "0.1.0", false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	charts := r.corpus.charts
+	if len(charts) != 2 || charts[0].File == charts[1].File {
+		t.Fatalf("saved %+v, want two charts in different files", charts)
+	}
+	for i, body := range []string{"first", "second"} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, charts[i].File))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != body {
+			t.Errorf("%s has %q, want %q", charts[i].File, data, body)
+		}
+	}
+}
+
+// failingTarget fails every push.
+type failingTarget struct{}
+
+func (failingTarget) Push(_ Doer, _, _ string, _ io.Reader, _ int64) error {
+	return &statusError{code: http.StatusServiceUnavailable}
+}
+
+func (failingTarget) String() string {
+	return "failing"
+}
+
+func TestPushCorpusRecordsSizeOnce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pusher-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "chart-0.1.0.tgz"), []byte("chart"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := newTestRoutine(t, scaffold(t), 1, WithTarget(failingTarget{}), WithCorpusRetries(2))
+	r.repeatFailures = true
+	r.pushCorpus(dir, []corpusChart{{Name: "chart", Version: "0.1.0", File: "chart-0.1.0.tgz", Size: 5}})
+
+	if r.completed != 3 {
+		t.Fatalf("pushed %d times, want 3 with 2 retries", r.completed)
+	}
+	if len(r.stats.packageSizes) != 1 {
+		t.Errorf("recorded %d package sizes for %d pushes of one chart, want 1", len(r.stats.packageSizes), r.completed)
+	}
+}
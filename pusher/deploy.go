@@ -0,0 +1,118 @@
+package pusher
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// Deploy pushes charts with a PUT of <URL>/<name>-<version>.tgz, which is how Helm repositories
+// of Artifactory and Nexus take them, with URL such as
+// https://artifactory.example.com/artifactory/helm-local. Charts that are new complete with
+// 201, while some registries complete with 200, such as when they replace a chart.
+type Deploy struct {
+	URL      string
+	Username string
+	Password string
+	// Checksums sends the SHA-256, SHA-1 and MD5 checksums of each chart in the X-Checksum headers,
+	// which Artifactory verifies the chart against. Charts are read into memory for them.
+	Checksums bool
+	// Name describes the registry.
+	Name string
+
+	// created and replaced count the pushes that completed with 201 and 200.
+	created  int64
+	replaced int64
+}
+
+// NewArtifactory returns a Deploy target for the Artifactory Helm repository at u, which is sent
+// the checksums of charts.
+func NewArtifactory(u, username, password string) *Deploy {
+	return &Deploy{URL: strings.TrimSuffix(u, "/"), Username: username, Password: password, Checksums: true, Name: "Artifactory"}
+}
+
+// NewNexus returns a Deploy target for the Nexus Helm repository at u, such as
+// https://nexus.example.com/repository/helm-hosted, which is sent the checksums of charts too, so
+// that the charts of both registries are pushed alike, although Nexus computes its own.
+func NewNexus(u, username, password string) *Deploy {
+	return &Deploy{URL: strings.TrimSuffix(u, "/"), Username: username, Password: password, Checksums: true, Name: "Nexus"}
+}
+
+func (t *Deploy) String() string {
+	return fmt.Sprintf("%s %s", t.Name, t.URL)
+}
+
+func (t *Deploy) Push(do Doer, name, version string, body io.Reader, size int64) error {
+	var md5Sum, sha1Sum, sha256Sum string
+	if t.Checksums {
+		var data []byte
+		if b, ok := body.(interface{ Bytes() []byte }); ok {
+			data = b.Bytes()
+		} else {
+			var err error
+			if data, err = ioutil.ReadAll(body); err != nil {
+				return err
+			}
+		}
+		body, size = bytes.NewReader(data), int64(len(data))
+		md5Sum = fmt.Sprintf("%x", md5.Sum(data))
+		sha1Sum = fmt.Sprintf("%x", sha1.Sum(data))
+		sha256Sum = fmt.Sprintf("%x", sha256.Sum256(data))
+	}
+
+	req, err := t.newRequest(http.MethodPut, t.chartURL(name, version), body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/gzip")
+	if t.Checksums {
+		req.Header.Set("X-Checksum", md5Sum)
+		req.Header.Set("X-Checksum-Sha1", sha1Sum)
+		req.Header.Set("X-Checksum-Sha256", sha256Sum)
+	}
+
+	resp, err := do.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+		atomic.AddInt64(&t.created, 1)
+		return nil
+	case http.StatusOK:
+		atomic.AddInt64(&t.replaced, 1)
+		return nil
+	default:
+		return &statusError{code: resp.StatusCode}
+	}
+}
+
+// Report writes how many pushes completed with 201 and with 200 to w.
+func (t *Deploy) Report(w io.Writer) {
+	created, replaced := atomic.LoadInt64(&t.created), atomic.LoadInt64(&t.replaced)
+	fmt.Fprintf(w, "* Deploys: %d created with 201, %d completed with 200 (%.2f perc)\n",
+		created, replaced, percent(replaced, created+replaced))
+}
+
+func (t *Deploy) chartURL(name, version string) string {
+	return fmt.Sprintf("%s/%s-%s.tgz", t.URL, name, version)
+}
+
+func (t *Deploy) newRequest(method, u string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(t.Username, t.Password)
+	return req, nil
+}
@@ -0,0 +1,89 @@
+package pusher
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// deployServer keeps the charts PUT to it, and completes the PUT of a chart that it has with 200.
+type deployServer struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	charts map[string][]byte
+	errs   []string
+}
+
+func newDeployServer() *deployServer {
+	d := &deployServer{charts: map[string][]byte{}}
+	d.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		if user, password, ok := req.BasicAuth(); !ok || user != "admin" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		checksums := map[string]string{
+			"X-Checksum":        fmt.Sprintf("%x", md5.Sum(body)),
+			"X-Checksum-Sha1":   fmt.Sprintf("%x", sha1.Sum(body)),
+			"X-Checksum-Sha256": fmt.Sprintf("%x", sha256.Sum256(body)),
+		}
+		for header, sum := range checksums {
+			if got := req.Header.Get(header); got != sum {
+				d.errs = append(d.errs, fmt.Sprintf("%s of %s is %q, want %q", header, req.URL.Path, got, sum))
+			}
+		}
+
+		_, exists := d.charts[req.URL.Path]
+		d.charts[req.URL.Path] = body
+		if exists {
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	return d
+}
+
+func TestDeploy(t *testing.T) {
+	for _, newTarget := range []func(u, username, password string) *Deploy{NewArtifactory, NewNexus} {
+		server := newDeployServer()
+		target := newTarget(server.URL+"/helm-local/", "admin", "secret")
+		t.Run(target.Name, func(t *testing.T) {
+			defer server.Close()
+			for _, body := range []string{"first", "second"} {
+				if err := target.Push(httpClient, "chart", "0.1.0", ioutil.NopCloser(strings.NewReader(body)), -1); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := target.Push(httpClient, "other", "1.0.0", strings.NewReader("other"), 5); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, err := range server.errs {
+				t.Error(err)
+			}
+			if got := string(server.charts["/helm-local/chart-0.1.0.tgz"]); got != "second" {
+				t.Errorf("chart-0.1.0.tgz has %q, want %q", got, "second")
+			}
+			if target.created != 2 || target.replaced != 1 {
+				t.Errorf("%d charts created and %d replaced, want 2 and 1", target.created, target.replaced)
+			}
+
+			target.Password = "wrong"
+			err := target.Push(httpClient, "chart", "0.2.0", strings.NewReader("chart"), 5)
+			if se, ok := err.(*statusError); !ok || se.code != http.StatusUnauthorized {
+				t.Errorf("push with the wrong password returned %v, want status 401", err)
+			}
+		})
+	}
+}
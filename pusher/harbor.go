@@ -0,0 +1,209 @@
+package pusher
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Harbor pushes charts to the chart repositories of the projects of a Harbor instance at URL, such
+// as https://harbor.example.com. Each chart is pushed to one of Projects, chosen by its name so
+// that every version of a chart goes to the same project. There must be at least one project.
+type Harbor struct {
+	URL      string
+	Projects []string
+	Username string
+	Password string
+	// CreateProjects creates the projects that do not exist before pushing to them.
+	CreateProjects bool
+
+	// mu guards projects, which has the creation of each project that has been created, that
+	// already existed, or that is being created.
+	mu       sync.Mutex
+	projects map[string]*projectCreation
+}
+
+// projectCreation is a request to create a project. Its err is set when done is closed.
+type projectCreation struct {
+	err  error
+	done chan struct{}
+}
+
+var (
+	errHarborProjects = errors.New("Harbor needs at least one project, and projects need names")
+)
+
+// NewHarbor returns a Harbor target for the instance at u.
+func NewHarbor(u string, projects []string, username, password string) *Harbor {
+	return &Harbor{URL: strings.TrimSuffix(u, "/"), Projects: projects, Username: username, Password: password}
+}
+
+func (t *Harbor) String() string {
+	s := fmt.Sprintf("Harbor %s, projects %s", t.URL, strings.Join(t.Projects, ", "))
+	if t.CreateProjects {
+		s += ", created if they do not exist"
+	}
+	return s
+}
+
+// Push uploads the chart to the chart repository of its project as a multipart form, which is
+// what the Harbor API takes.
+func (t *Harbor) Push(do Doer, name, _ string, body io.Reader, size int64) error {
+	project := t.project(name)
+	if t.CreateProjects {
+		if err := t.createProject(do, project); err != nil {
+			return err
+		}
+	}
+
+	head := &bytes.Buffer{}
+	mw := multipart.NewWriter(head)
+	if _, err := mw.CreateFormFile("chart", name+".tgz"); err != nil {
+		return err
+	}
+	tail := "\r\n--" + mw.Boundary() + "--\r\n"
+
+	req, err := t.newRequest(http.MethodPost, t.chartrepo(project), io.MultiReader(head, body, strings.NewReader(tail)))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = -1
+	if size >= 0 {
+		req.ContentLength = int64(head.Len()) + size + int64(len(tail))
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return expectHarbor(do, req, http.StatusCreated)
+}
+
+// project returns the project that the chart with the given name is pushed to.
+func (t *Harbor) project(name string) string {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return t.Projects[h.Sum32()%uint32(len(t.Projects))]
+}
+
+// validate returns an error if charts cannot be spread across the projects.
+func (t *Harbor) validate() error {
+	if len(t.Projects) == 0 {
+		return errHarborProjects
+	}
+	for _, p := range t.Projects {
+		if p == "" {
+			return errHarborProjects
+		}
+	}
+	return nil
+}
+
+// createProject creates project, unless it has been created before. A project that already
+// exists is not an error. Routines that push to a project that is being created wait for it,
+// and projects that could not be created are tried again by the next push to them.
+func (t *Harbor) createProject(do Doer, project string) error {
+	t.mu.Lock()
+	pc, ok := t.projects[project]
+	if !ok {
+		pc = &projectCreation{done: make(chan struct{})}
+		if t.projects == nil {
+			t.projects = map[string]*projectCreation{}
+		}
+		t.projects[project] = pc
+	}
+	t.mu.Unlock()
+	if ok {
+		<-pc.done
+		return pc.err
+	}
+
+	pc.err = t.postProject(do, project)
+	if pc.err != nil {
+		t.mu.Lock()
+		delete(t.projects, project)
+		t.mu.Unlock()
+	}
+	close(pc.done)
+	return pc.err
+}
+
+func (t *Harbor) postProject(do Doer, project string) error {
+	data, err := json.Marshal(map[string]interface{}{"project_name": project})
+	if err != nil {
+		return err
+	}
+	req, err := t.newRequest(http.MethodPost, t.URL+"/api/v2.0/projects", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := expectHarbor(do, req, http.StatusCreated); err != nil {
+		if e, ok := err.(*statusError); !ok || e.code != http.StatusConflict {
+			return fmt.Errorf("failed to create project %s: %w", project, err)
+		}
+	}
+	return nil
+}
+
+func (t *Harbor) chartrepo(project string) string {
+	return fmt.Sprintf("%s/api/chartrepo/%s/charts", t.URL, project)
+}
+
+func (t *Harbor) newRequest(method, u string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(t.Username, t.Password)
+	return req, nil
+}
+
+// expectHarbor sends req and returns an error with the error message of Harbor unless it
+// completes with the given status.
+func expectHarbor(do Doer, req *http.Request, status int) error {
+	resp, err := do.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != status {
+		return harborError(resp)
+	}
+	return nil
+}
+
+// harborError reads the error of a Harbor response. The Harbor API describes errors as
+// {"errors":[{"code":"...","message":"..."}]}, and its chart repositories as {"error":"..."}.
+func harborError(resp *http.Response) error {
+	body := struct {
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+		Error string `json:"error"`
+	}{}
+	e := &statusError{code: resp.StatusCode}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body); err != nil {
+		return e
+	}
+
+	var messages, codes []string
+	for _, be := range body.Errors {
+		messages = append(messages, strings.TrimPrefix(be.Code+": "+be.Message, ": "))
+		if be.Code != "" {
+			codes = append(codes, be.Code)
+		}
+	}
+	if body.Error != "" {
+		messages = append(messages, body.Error)
+	}
+	// Messages name the chart or project, so errors are of the kind of their codes.
+	e.message = strings.Join(messages, "; ")
+	e.kind = strings.Join(codes, "; ")
+	return e
+}
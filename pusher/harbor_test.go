@@ -0,0 +1,168 @@
+package pusher
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// harborServer is a Harbor instance that keeps the charts uploaded to it, and creates projects
+// after a delay.
+type harborServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	projects map[string]int
+	charts   map[string][]byte
+	errs     []string
+}
+
+func newHarborServer(projects ...string) *harborServer {
+	h := &harborServer{projects: map[string]int{}, charts: map[string][]byte{}}
+	for _, p := range projects {
+		h.projects[p] = 0
+	}
+	h.Server = httptest.NewServer(http.HandlerFunc(h.serve))
+	return h
+}
+
+func (h *harborServer) serve(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/api/v2.0/projects" {
+		body, _ := ioutil.ReadAll(req.Body)
+		project := strings.TrimSuffix(strings.TrimPrefix(string(body), `{"project_name":"`), `"}`)
+		time.Sleep(20 * time.Millisecond)
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.projects[project]; ok {
+			h.projects[project]++
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprintf(w, `{"errors":[{"code":"CONFLICT","message":"The project named %s already exists"}]}`, project)
+			return
+		}
+		h.projects[project] = 1
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+
+	project := strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, "/api/chartrepo/"), "/charts")
+	body, _ := ioutil.ReadAll(req.Body)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if req.ContentLength >= 0 && req.ContentLength != int64(len(body)) {
+		h.errs = append(h.errs, fmt.Sprintf("request has length %d, but a body of %d bytes", req.ContentLength, len(body)))
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	f, fh, err := req.FormFile("chart")
+	if err != nil {
+		h.errs = append(h.errs, fmt.Sprintf("invalid form: %v", err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	data, _ := ioutil.ReadAll(f)
+	if _, ok := h.charts[project+"/"+fh.Filename]; ok {
+		w.WriteHeader(http.StatusConflict)
+		fmt.Fprintf(w, `{"error":"%s already exists"}`, fh.Filename)
+		return
+	}
+	h.charts[project+"/"+fh.Filename] = data
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (h *harborServer) check(t *testing.T) {
+	t.Helper()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, err := range h.errs {
+		t.Error(err)
+	}
+}
+
+func TestHarborPush(t *testing.T) {
+	server := newHarborServer()
+	defer server.Close()
+	target := NewHarbor(server.URL, []string{"a", "b"}, "admin", "secret")
+
+	for _, size := range []int64{5, -1} {
+		name := fmt.Sprintf("chart%d", size)
+		if err := target.Push(httpClient, name, "0.1.0", strings.NewReader("chart"), size); err != nil {
+			t.Fatalf("push of %d bytes: %v", size, err)
+		}
+		if got := server.charts[target.project(name)+"/"+name+".tgz"]; string(got) != "chart" {
+			t.Errorf("uploaded %q for a push of %d bytes, want %q", got, size, "chart")
+		}
+	}
+	server.check(t)
+
+	err := target.Push(httpClient, "chart5", "0.1.0", strings.NewReader("chart"), 5)
+	if se, ok := err.(*statusError); !ok || se.code != http.StatusConflict || se.message != "chart5.tgz already exists" {
+		t.Errorf("push of an existing chart returned %v, want 409 with the message of Harbor", err)
+	}
+}
+
+func TestHarborCreatesProjectsOnce(t *testing.T) {
+	server := newHarborServer("existing")
+	defer server.Close()
+	target := NewHarbor(server.URL, []string{"existing", "created"}, "admin", "secret")
+	target.CreateProjects = true
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := target.Push(httpClient, fmt.Sprintf("chart%d", i), "0.1.0", strings.NewReader("chart"), 5); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	server.check(t)
+
+	// Projects that already exist are created with a 409, which is not an error.
+	for project, created := range server.projects {
+		if created != 1 {
+			t.Errorf("project %s was created %d times, want 1", project, created)
+		}
+	}
+}
+
+func TestHarborError(t *testing.T) {
+	tests := []struct {
+		body    string
+		message string
+		kind    string
+	}{
+		{`{"errors":[{"code":"FORBIDDEN","message":"forbidden to push chart1"}]}`, "FORBIDDEN: forbidden to push chart1", "returned with status 403: FORBIDDEN"},
+		{`{"errors":[{"code":"DENIED","message":"a"},{"message":"b"}]}`, "DENIED: a; b", "returned with status 403: DENIED"},
+		{`{"error":"chart1-0.1.0.tgz already exists"}`, "chart1-0.1.0.tgz already exists", "returned with status 403"},
+		{`<html>forbidden</html>`, "", "returned with status 403"},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{StatusCode: http.StatusForbidden, Body: ioutil.NopCloser(strings.NewReader(tt.body))}
+		err := harborError(resp)
+		se, ok := err.(*statusError)
+		if !ok || se.code != http.StatusForbidden || se.message != tt.message {
+			t.Errorf("error of %s is %#v, want 403 with message %q", tt.body, err, tt.message)
+			continue
+		}
+		if kind := errorKind(fmt.Errorf("failed to push: %w", err)); kind != "failed to push: "+tt.kind {
+			t.Errorf("kind of error of %s is %q, want %q", tt.body, kind, "failed to push: "+tt.kind)
+		}
+	}
+}
+
+func TestHarborNeedsProjects(t *testing.T) {
+	for _, projects := range [][]string{nil, {""}, {"a", ""}} {
+		o := defaultOptions()
+		WithTarget(NewHarbor("https://harbor.example.com", projects, "", ""))(&o)
+		if err := o.validate(); err != errHarborProjects {
+			t.Errorf("validate with projects %q returned %v, want %v", projects, err, errHarborProjects)
+		}
+	}
+}
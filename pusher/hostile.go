@@ -0,0 +1,416 @@
+package pusher
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/wahabmk/helm-pusher/pkg/helm"
+	"github.com/wahabmk/helm-pusher/pkg/random"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+const (
+	// bombSize is the uncompressed size of the file in a gzip bomb.
+	bombSize = 256 << 20
+	// oversizedSize is the size of the incompressible file in an oversized chart, which is
+	// larger than the default upload limit of most registries.
+	oversizedSize = 32 << 20
+)
+
+// hostileCase generates a malformed or malicious chart archive that the registry is expected
+// to reject with a 4xx status.
+type hostileCase struct {
+	name        string
+	description string
+	build       func(entropy *random.Entropy, c *chart.Chart) ([]byte, error)
+	// shared is set for cases that are too expensive to build for every push, which are built
+	// once, from the first chart they are pushed as, and pushed with the same body every time.
+	shared *sharedBody
+}
+
+// sharedBody is the body of a hostile case that is built once.
+type sharedBody struct {
+	once sync.Once
+	body []byte
+	err  error
+}
+
+// body builds the archive of the hostile case from c, or returns the archive it was built
+// as before if it is shared.
+func (hc hostileCase) body(entropy *random.Entropy, c *chart.Chart) ([]byte, error) {
+	if hc.shared == nil {
+		return hc.build(entropy, c)
+	}
+	hc.shared.once.Do(func() {
+		hc.shared.body, hc.shared.err = hc.build(entropy, c)
+	})
+	return hc.shared.body, hc.shared.err
+}
+
+var (
+	hostileCases = []hostileCase{
+		{"invalid-chart-yaml", "Chart.yaml that is not valid YAML", buildInvalidChartYAML, nil},
+		{"invalid-semver", "version that is not semantic", buildInvalidSemver, nil},
+		{"path-traversal", "chart name with ../ that escapes the archive", buildPathTraversal, nil},
+		{"absolute-paths", "tar entries with absolute paths", buildAbsolutePaths, nil},
+		{"symlink", "tar entry that is a symlink to /etc/passwd", buildSymlink, nil},
+		{"duplicate-entries", "two different Chart.yaml entries", buildDuplicateEntries, nil},
+		{"truncated-gzip", "gzip stream cut in half", buildTruncatedGzip, nil},
+		{"gzip-bomb", fmt.Sprintf("file that expands to %d MiB", bombSize>>20), buildGzipBomb, &sharedBody{}},
+		{"not-gzip", "uncompressed tar body", buildNotGzip, nil},
+		{"oversized-file", fmt.Sprintf("incompressible %d MiB file", oversizedSize>>20), buildOversizedFile, &sharedBody{}},
+	}
+)
+
+// HostileCases returns the names of the hostile charts that can be generated.
+func HostileCases() []string {
+	names := make([]string, len(hostileCases))
+	for i, hc := range hostileCases {
+		names[i] = hc.name
+	}
+	return names
+}
+
+// WithHostileCharts replaces the given fraction, between 0 and 1, of chart pushes with malformed
+// or malicious archives. The registry is expected to reject each of them with a 4xx status, and
+// the results report every case for which it did not. If no case names are given, all of them are
+// used, and names that are not among HostileCases are an error.
+func WithHostileCharts(fraction float64, cases ...string) Option {
+	return func(o *options) {
+		o.hostile = fraction
+		o.hostileCases = nil
+		o.unknownHostileCases = nil
+		for _, name := range cases {
+			known := false
+			for _, hc := range hostileCases {
+				if hc.name == name {
+					o.hostileCases = append(o.hostileCases, hc)
+					known = true
+				}
+			}
+			if !known {
+				o.unknownHostileCases = append(o.unknownHostileCases, name)
+			}
+		}
+		if len(cases) == 0 {
+			o.hostileCases = hostileCases
+		}
+	}
+}
+
+// hostileResult counts how the registry responded to a hostile case.
+type hostileResult struct {
+	description string
+	pushed      int64
+	rejected    int64
+	accepted    int64
+	serverError int64
+	failed      int64
+	// local counts the pushes that failed before a request was sent, such as when the target
+	// could not read the chart itself, which the server cannot have deviated on.
+	local int64
+	// others has the statuses that are neither 2xx, 4xx nor 5xx.
+	others map[int]int64
+}
+
+func (h *hostileResult) merge(h2 *hostileResult) {
+	h.description = h2.description
+	h.pushed += h2.pushed
+	h.rejected += h2.rejected
+	h.accepted += h2.accepted
+	h.serverError += h2.serverError
+	h.failed += h2.failed
+	h.local += h2.local
+	for code, n := range h2.others {
+		if h.others == nil {
+			h.others = map[int]int64{}
+		}
+		h.others[code] += n
+	}
+}
+
+func (h *hostileResult) deviated() bool {
+	return h.pushed-h.local != h.rejected
+}
+
+// printHostile writes how the registry responded to each hostile case to w.
+func printHostile(w io.Writer, results map[string]*hostileResult) {
+	if len(results) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(results))
+	for name := range results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var deviations []string
+	fmt.Fprintf(w, "* Hostile charts (expected to be rejected with 4xx):\n")
+	for _, name := range names {
+		h := results[name]
+		fmt.Fprintf(w, "\t%s (%s): %d pushed, %d rejected with 4xx, %d accepted, %d with 5xx, %d failed, %d failed locally",
+			name, h.description, h.pushed, h.rejected, h.accepted, h.serverError, h.failed, h.local)
+		for code, n := range h.others {
+			fmt.Fprintf(w, ", %d with %d", n, code)
+		}
+		fmt.Fprintf(w, "\n")
+		if h.deviated() {
+			deviations = append(deviations, name)
+		}
+	}
+
+	fmt.Fprintf(w, "* Hostile charts where the server deviated: ")
+	if len(deviations) == 0 {
+		fmt.Fprintf(w, "None")
+	}
+	fmt.Fprintf(w, "%s\n", strings.Join(deviations, ", "))
+}
+
+// pushHostile pushes a randomly picked hostile case and records how the registry responded.
+func (r *routine) pushHostile(entropy *random.Entropy, name, version string) {
+	hc := r.opts.hostileCases[entropy.Intn(len(r.opts.hostileCases))]
+
+	r.chart.Metadata.Name = name
+	r.chart.Metadata.Version = version
+	body, err := hc.body(entropy, copyChart(r.chart))
+	if err != nil {
+		r.recordError(fmt.Errorf("failed to build hostile chart %q: %w", hc.name, err))
+		return
+	}
+
+	if r.stats.hostile == nil {
+		r.stats.hostile = map[string]*hostileResult{}
+	}
+	result, ok := r.stats.hostile[hc.name]
+	if !ok {
+		result = &hostileResult{description: hc.description}
+		r.stats.hostile[hc.name] = result
+	}
+	result.pushed++
+
+	sent := r.stats.requests
+	err = r.opts.target.Push(r, name, version, bytes.NewReader(body), int64(len(body)))
+	var se *statusError
+	switch {
+	case err != nil && r.stats.requests == sent:
+		result.local++
+	case err == nil:
+		result.accepted++
+	case errors.As(err, &se) && se.code >= 400 && se.code < 500:
+		result.rejected++
+	case errors.As(err, &se) && se.code >= 500:
+		result.serverError++
+	case errors.As(err, &se) && se.code >= 200 && se.code < 300:
+		result.accepted++
+	case errors.As(err, &se):
+		if result.others == nil {
+			result.others = map[int]int64{}
+		}
+		result.others[se.code]++
+	default:
+		result.failed++
+	}
+}
+
+// tarEntry is a single entry of a chart archive.
+type tarEntry struct {
+	header *tar.Header
+	body   []byte
+}
+
+// entries packages c and returns the entries of its archive.
+func entries(c *chart.Chart) ([]tarEntry, error) {
+	buf, err := helm.PackageChart(c)
+	if err != nil {
+		return nil, err
+	}
+
+	zr, err := gzip.NewReader(buf)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(zr)
+
+	var out []tarEntry
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		body, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, tarEntry{header: h, body: body})
+	}
+}
+
+// archive writes entries to a tar archive, which is compressed with gzip if compress is set.
+func archive(entries []tarEntry, compress bool) ([]byte, error) {
+	buf := &bytes.Buffer{}
+
+	var w io.Writer = buf
+	var zw *gzip.Writer
+	if compress {
+		zw = gzip.NewWriter(buf)
+		w = zw
+	}
+
+	tw := tar.NewWriter(w)
+	for _, e := range entries {
+		h := *e.header
+		h.Size = int64(len(e.body))
+		if h.Typeflag == tar.TypeSymlink {
+			h.Size = 0
+		}
+		if err := tw.WriteHeader(&h); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(e.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// withEntry returns the entries of c with an additional file at the given path within the chart.
+func withEntry(c *chart.Chart, name string, body []byte) ([]tarEntry, error) {
+	es, err := entries(c)
+	if err != nil {
+		return nil, err
+	}
+	h := *es[0].header
+	h.Name = path.Join(c.Name(), name)
+	return append(es, tarEntry{header: &h, body: body}), nil
+}
+
+func buildInvalidChartYAML(_ *random.Entropy, c *chart.Chart) ([]byte, error) {
+	es, err := entries(c)
+	if err != nil {
+		return nil, err
+	}
+	for i := range es {
+		if es[i].header.Name == path.Join(c.Name(), chartutil.ChartfileName) {
+			es[i].body = []byte(fmt.Sprintf("apiVersion: v2\nname: %s\nversion: [%s\n  description: {{ unterminated\n", c.Name(), c.Metadata.Version))
+		}
+	}
+	return archive(es, true)
+}
+
+func buildInvalidSemver(_ *random.Entropy, c *chart.Chart) ([]byte, error) {
+	c.Metadata.Version = "not-a-version"
+	es, err := entries(c)
+	if err != nil {
+		return nil, err
+	}
+	return archive(es, true)
+}
+
+func buildPathTraversal(_ *random.Entropy, c *chart.Chart) ([]byte, error) {
+	c.Metadata.Name = "../../" + c.Metadata.Name
+	es, err := entries(c)
+	if err != nil {
+		return nil, err
+	}
+	return archive(es, true)
+}
+
+func buildAbsolutePaths(_ *random.Entropy, c *chart.Chart) ([]byte, error) {
+	es, err := entries(c)
+	if err != nil {
+		return nil, err
+	}
+	for i := range es {
+		es[i].header.Name = "/" + es[i].header.Name
+	}
+	return archive(es, true)
+}
+
+func buildSymlink(_ *random.Entropy, c *chart.Chart) ([]byte, error) {
+	es, err := withEntry(c, "templates/passwd.yaml", nil)
+	if err != nil {
+		return nil, err
+	}
+	link := es[len(es)-1].header
+	link.Typeflag = tar.TypeSymlink
+	link.Linkname = "/etc/passwd"
+	return archive(es, true)
+}
+
+func buildDuplicateEntries(_ *random.Entropy, c *chart.Chart) ([]byte, error) {
+	es, err := entries(c)
+	if err != nil {
+		return nil, err
+	}
+
+	dup := copyChart(c)
+	dup.Metadata.Version = "0.0.0-duplicate"
+	dupEntries, err := entries(dup)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range dupEntries {
+		if e.header.Name == path.Join(c.Name(), chartutil.ChartfileName) {
+			es = append(es, e)
+		}
+	}
+	return archive(es, true)
+}
+
+func buildTruncatedGzip(_ *random.Entropy, c *chart.Chart) ([]byte, error) {
+	buf, err := helm.PackageChart(c)
+	if err != nil {
+		return nil, err
+	}
+	b := buf.Bytes()
+	return b[:len(b)/2], nil
+}
+
+func buildGzipBomb(_ *random.Entropy, c *chart.Chart) ([]byte, error) {
+	es, err := withEntry(c, "files/bomb", make([]byte, bombSize))
+	if err != nil {
+		return nil, err
+	}
+	return archive(es, true)
+}
+
+func buildNotGzip(_ *random.Entropy, c *chart.Chart) ([]byte, error) {
+	es, err := entries(c)
+	if err != nil {
+		return nil, err
+	}
+	return archive(es, false)
+}
+
+func buildOversizedFile(entropy *random.Entropy, c *chart.Chart) ([]byte, error) {
+	data := make([]byte, oversizedSize)
+	entropy.Rand.Read(data)
+	es, err := withEntry(c, "files/oversized", data)
+	if err != nil {
+		return nil, err
+	}
+	return archive(es, true)
+}
@@ -0,0 +1,106 @@
+package pusher
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/wahabmk/helm-pusher/pkg/random"
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+func TestSharedHostileBodyIsBuiltOnce(t *testing.T) {
+	var builds int
+	hc := hostileCase{
+		name: "counted",
+		build: func(_ *random.Entropy, c *chart.Chart) ([]byte, error) {
+			builds++
+			return []byte(c.Name()), nil
+		},
+		shared: &sharedBody{},
+	}
+
+	c := scaffold(t)
+	first, err := hc.body(random.New(1), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Metadata.Name = "other"
+	second, err := hc.body(random.New(1), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if builds != 1 || !bytes.Equal(first, second) {
+		t.Errorf("built %d times, bodies %q and %q, want one build of the same body", builds, first, second)
+	}
+}
+
+// localTarget fails to push charts that are not gzip streams without sending a request, and
+// sends the others to URL.
+type localTarget struct {
+	URL string
+}
+
+func (t localTarget) Push(do Doer, _, _ string, body io.Reader, _ int64) error {
+	var magic [2]byte
+	if _, err := io.ReadFull(body, magic[:]); err != nil || magic != [2]byte{0x1f, 0x8b} {
+		return errors.New("not a gzip stream")
+	}
+	req, err := http.NewRequest(http.MethodPost, t.URL, body)
+	if err != nil {
+		return err
+	}
+	resp, err := do.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return &statusError{code: resp.StatusCode}
+}
+
+func (localTarget) String() string {
+	return "local"
+}
+
+func TestHostileLocalFailuresAreNotDeviations(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	r := newTestRoutine(t, scaffold(t), 1, WithTarget(localTarget{URL: server.URL}), WithHostileCharts(1, "not-gzip", "invalid-semver"))
+	entropy := random.New(1)
+	for i := 0; i < 20; i++ {
+		r.pushHostile(entropy, "hostile", "0.1.0")
+	}
+
+	notGzip, invalid := r.stats.hostile["not-gzip"], r.stats.hostile["invalid-semver"]
+	if notGzip == nil || invalid == nil {
+		t.Fatalf("results are %v, want both cases", r.stats.hostile)
+	}
+	if notGzip.local != notGzip.pushed || notGzip.deviated() {
+		t.Errorf("not-gzip: %d of %d failed locally, deviated %v", notGzip.local, notGzip.pushed, notGzip.deviated())
+	}
+	if invalid.rejected != invalid.pushed || invalid.deviated() {
+		t.Errorf("invalid-semver: %d of %d rejected, deviated %v", invalid.rejected, invalid.pushed, invalid.deviated())
+	}
+}
+
+func TestUnknownHostileCasesAreRejected(t *testing.T) {
+	o := defaultOptions()
+	WithHostileCharts(0.5, "not-gzip", "gzip-bmob")(&o)
+	err := o.validate()
+	if err == nil || !strings.Contains(err.Error(), "gzip-bmob") || !strings.Contains(err.Error(), "gzip-bomb") {
+		t.Errorf("validate returned %v, want an error naming the unknown and the known cases", err)
+	}
+
+	o = defaultOptions()
+	WithHostileCharts(0.5, "not-gzip")(&o)
+	if err := o.validate(); err != nil || len(o.hostileCases) != 1 {
+		t.Errorf("validate returned %v with %d cases, want 1 case", err, len(o.hostileCases))
+	}
+}
@@ -0,0 +1,59 @@
+package pusher
+
+import (
+	"fmt"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	requirementsFile     = "requirements.yaml"
+	requirementsLockFile = "requirements.lock"
+)
+
+// WithLegacyCharts generates the given fraction, between 0 and 1, of charts as Helm 2 era
+// apiVersion v1 charts.
+func WithLegacyCharts(fraction float64) Option {
+	return func(o *options) {
+		o.legacy = fraction
+	}
+}
+
+// legacyChart returns a copy of c, and of its subcharts, as an apiVersion v1 chart. Dependencies
+// are listed in requirements.yaml and locked in requirements.lock instead of Chart.yaml and
+// Chart.lock, which is how the Helm loader represents v1 charts.
+func legacyChart(c *chart.Chart) (*chart.Chart, error) {
+	cp := copyChart(c)
+	cp.Metadata.APIVersion = chart.APIVersionV1
+	// The type field was only introduced with apiVersion v2.
+	cp.Metadata.Type = ""
+	cp.Lock = nil
+
+	if len(c.Metadata.Dependencies) > 0 {
+		data, err := yaml.Marshal(map[string]interface{}{"dependencies": c.Metadata.Dependencies})
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal %s: %w", requirementsFile, err)
+		}
+		cp.Files = withFile(cp.Files, &chart.File{Name: requirementsFile, Data: data})
+	}
+	if c.Lock != nil {
+		data, err := yaml.Marshal(c.Lock)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal %s: %w", requirementsLockFile, err)
+		}
+		cp.Files = withFile(cp.Files, &chart.File{Name: requirementsLockFile, Data: data})
+	}
+
+	subcharts := make([]*chart.Chart, 0, len(c.Dependencies()))
+	for _, sub := range c.Dependencies() {
+		legacySub, err := legacyChart(sub)
+		if err != nil {
+			return nil, err
+		}
+		subcharts = append(subcharts, legacySub)
+	}
+	cp.SetDependencies(subcharts...)
+
+	return cp, nil
+}
@@ -0,0 +1,69 @@
+package pusher
+
+import (
+	"reflect"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+func TestLegacyChartLoads(t *testing.T) {
+	s := Structure{Templates: 1, Subcharts: 2, SubchartDepth: 2, Lock: true}
+	r, _ := structuredChart(t, s)
+	legacy, err := legacyChart(r.chart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := r.opts.packager.Package(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loader.LoadArchive(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The loader reads dependencies from requirements.yaml and their lock from requirements.lock.
+	checkStructure(t, s, loaded, s.SubchartDepth)
+	var checkLegacy func(c, original *chart.Chart)
+	checkLegacy = func(c, original *chart.Chart) {
+		if c.Metadata.APIVersion != chart.APIVersionV1 || c.Metadata.Type != "" {
+			t.Errorf("%s has apiVersion %q and type %q, want v1 without a type", c.ChartFullPath(), c.Metadata.APIVersion, c.Metadata.Type)
+		}
+		raw := map[string]bool{}
+		for _, f := range c.Raw {
+			raw[f.Name] = true
+		}
+		if !raw[requirementsFile] || !raw[requirementsLockFile] || raw["Chart.lock"] {
+			t.Errorf("%s has files %v, want %s and %s instead of Chart.lock", c.ChartFullPath(), raw, requirementsFile, requirementsLockFile)
+		}
+		if !reflect.DeepEqual(c.Metadata.Dependencies, original.Metadata.Dependencies) {
+			t.Errorf("%s has dependencies %v, want %v", c.ChartFullPath(), c.Metadata.Dependencies, original.Metadata.Dependencies)
+		}
+		if c.Lock.Digest != original.Lock.Digest {
+			t.Errorf("%s has lock digest %s, want %s", c.ChartFullPath(), c.Lock.Digest, original.Lock.Digest)
+		}
+
+		subcharts := map[string]*chart.Chart{}
+		for _, sub := range original.Dependencies() {
+			subcharts[sub.Name()] = sub
+		}
+		for _, sub := range c.Dependencies() {
+			if len(sub.Dependencies()) > 0 {
+				checkLegacy(sub, subcharts[sub.Name()])
+			}
+		}
+	}
+	checkLegacy(loaded, r.chart)
+
+	// The chart that the legacy chart was copied from is left as it is.
+	if r.chart.Metadata.APIVersion != chart.APIVersionV2 || r.chart.Lock == nil {
+		t.Errorf("template chart has apiVersion %q and lock %v, want v2 with a lock", r.chart.Metadata.APIVersion, r.chart.Lock)
+	}
+	for _, sub := range r.chart.Dependencies() {
+		if sub.Parent() != r.chart || sub.Metadata.APIVersion != chart.APIVersionV2 {
+			t.Errorf("%s of the template chart was changed", sub.ChartFullPath())
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package pusher
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/wahabmk/helm-pusher/pkg/random"
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+var (
+	kubeVersions = []string{">=1.16.0-0", ">=1.19.0-0", "^1.18.0", "~1.20.0", ">= 1.19.0 < 1.25.0", ">=1.21.0-0 <1.27.0-0"}
+	licenses     = []string{"Apache-2.0", "MIT", "BSD-3-Clause", "GPL-3.0-only"}
+	categories   = []string{"Database", "Monitoring", "Networking", "Security", "Storage", "Streaming"}
+)
+
+// MetadataProbabilities are the probabilities, between 0 and 1, with which each optional Chart.yaml
+// field is generated for a chart. Fields that are not generated keep the value of the template chart.
+type MetadataProbabilities struct {
+	AppVersion  float64
+	Description float64
+	Keywords    float64
+	Maintainers float64
+	Home        float64
+	Sources     float64
+	Icon        float64
+	Annotations float64
+	KubeVersion float64
+	// Library makes the chart a library chart instead of an application chart.
+	Library    float64
+	Deprecated float64
+}
+
+var (
+	// FullMetadata generates every optional field, but keeps charts deployable and current.
+	FullMetadata = MetadataProbabilities{
+		AppVersion:  1,
+		Description: 1,
+		Keywords:    1,
+		Maintainers: 1,
+		Home:        1,
+		Sources:     1,
+		Icon:        1,
+		Annotations: 1,
+		KubeVersion: 1,
+	}
+)
+
+func (m MetadataProbabilities) String() string {
+	return fmt.Sprintf("appVersion %.2f, description %.2f, keywords %.2f, maintainers %.2f, home %.2f, sources %.2f, "+
+		"icon %.2f, annotations %.2f, kubeVersion %.2f, library %.2f, deprecated %.2f",
+		m.AppVersion, m.Description, m.Keywords, m.Maintainers, m.Home, m.Sources,
+		m.Icon, m.Annotations, m.KubeVersion, m.Library, m.Deprecated)
+}
+
+// WithMetadata generates the optional Chart.yaml fields of every chart with the probabilities in m.
+func WithMetadata(m MetadataProbabilities) Option {
+	return func(o *options) {
+		o.metadata = &m
+	}
+}
+
+// generateMetadata replaces the metadata of the chart with that of the template chart, to which
+// the optional fields are randomly added.
+func (r *routine) generateMetadata(entropy *random.Entropy, name, version string) {
+	if r.baseMetadata == nil {
+		md := *r.chart.Metadata
+		r.baseMetadata = &md
+	}
+	md := *r.baseMetadata
+	md.Name = name
+	md.Version = version
+
+	m := r.opts.metadata
+	host := strings.ToLower(name)
+	chance := func(p float64) bool { return p > 0 && entropy.Float64() < p }
+	word := func(words []string) string { return words[entropy.Intn(len(words))] }
+
+	if chance(m.AppVersion) {
+		md.AppVersion = fmt.Sprintf("%d.%d.%d", entropy.Intn(10), entropy.Intn(30), entropy.Intn(100))
+		if chance(0.3) {
+			md.AppVersion = "v" + md.AppVersion
+		}
+	}
+	if chance(m.Description) {
+		md.Description = fmt.Sprintf("A Helm chart that deploys a %s %s for %s workloads",
+			word(random.Adjectives), word(random.Nouns), strings.ToLower(word(categories)))
+	}
+	if chance(m.Keywords) {
+		md.Keywords = nil
+		for n := 1 + entropy.Intn(5); n > 0; n-- {
+			md.Keywords = append(md.Keywords, word(random.Nouns))
+		}
+	}
+	if chance(m.Maintainers) {
+		md.Maintainers = nil
+		for n := 1 + entropy.Intn(3); n > 0; n-- {
+			user := fmt.Sprintf("%s-%s", word(random.Adjectives), word(random.Nouns))
+			md.Maintainers = append(md.Maintainers, &chart.Maintainer{
+				Name:  user,
+				Email: fmt.Sprintf("%s@example.com", user),
+				URL:   fmt.Sprintf("https://github.com/%s", user),
+			})
+		}
+	}
+	if chance(m.Home) {
+		md.Home = fmt.Sprintf("https://%s.example.com", host)
+	}
+	if chance(m.Sources) {
+		md.Sources = []string{fmt.Sprintf("https://github.com/example/%s", host)}
+		if chance(0.5) {
+			md.Sources = append(md.Sources, fmt.Sprintf("https://hub.example.com/r/example/%s", host))
+		}
+	}
+	if chance(m.Icon) {
+		md.Icon = fmt.Sprintf("https://%s.example.com/icon.png", host)
+	}
+	if chance(m.Annotations) {
+		md.Annotations = map[string]string{
+			"category":                               word(categories),
+			"licenses":                               word(licenses),
+			"artifacthub.io/changes":                 fmt.Sprintf("- kind: changed\n  description: Bump to %s\n", version),
+			"artifacthub.io/containsSecurityUpdates": fmt.Sprintf("%v", chance(0.1)),
+		}
+	}
+	if chance(m.KubeVersion) {
+		md.KubeVersion = word(kubeVersions)
+	}
+	if chance(m.Library) {
+		md.Type = "library"
+	}
+	if chance(m.Deprecated) {
+		md.Deprecated = true
+	}
+
+	r.chart.Metadata = &md
+}
@@ -0,0 +1,89 @@
+package pusher
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"testing"
+
+	"github.com/wahabmk/helm-pusher/pkg/random"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"sigs.k8s.io/yaml"
+)
+
+func TestGeneratedMetadataIsValid(t *testing.T) {
+	const charts = 200
+	m := FullMetadata
+	m.Library, m.Deprecated = 0.5, 0.5
+	r := newTestRoutine(t, scaffold(t), charts, WithMetadata(m))
+
+	entropy := random.New(1)
+	var library, deprecated int
+	for i := 0; i < charts; i++ {
+		// Every other chart is a legacy chart, which cannot be a library chart.
+		legacy := i%2 == 1
+		reader, _, err := r.generateChart(entropy, fmt.Sprintf("chart%d", i), fmt.Sprintf("1.0.%d", i), legacy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The Chart.yaml that was written is valid on its own, and as part of the chart.
+		md := &chart.Metadata{}
+		if err := yaml.Unmarshal(chartfile(t, data), md); err != nil {
+			t.Fatal(err)
+		}
+		if err := md.Validate(); err != nil {
+			t.Fatalf("Chart.yaml of chart%d is invalid: %v", i, err)
+		}
+		c, err := loader.LoadArchive(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("chart%d: %v", i, err)
+		}
+		if err := c.Validate(); err != nil {
+			t.Fatalf("chart%d is invalid: %v", i, err)
+		}
+
+		if md.AppVersion == "" || md.Description == "" || len(md.Keywords) == 0 || len(md.Maintainers) == 0 || md.Home == "" ||
+			len(md.Sources) == 0 || md.Icon == "" || len(md.Annotations) == 0 || md.KubeVersion == "" {
+			t.Errorf("chart%d is missing fields that are always generated: %+v", i, md)
+		}
+		if md.Type == "library" {
+			if legacy {
+				t.Errorf("legacy chart%d is a library chart", i)
+			}
+			library++
+		}
+		if md.Deprecated {
+			deprecated++
+		}
+	}
+
+	for name, got := range map[string]float64{"library": float64(library) / (charts / 2), "deprecated": float64(deprecated) / charts} {
+		if math.Abs(got-0.5) > 0.1 {
+			t.Errorf("%.2f of charts are %s, want 0.5", got, name)
+		}
+	}
+}
+
+// chartfile returns the Chart.yaml of the chart in the archive data.
+func chartfile(t *testing.T, data []byte) []byte {
+	t.Helper()
+	files, err := loader.LoadArchiveFiles(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if f.Name == chartutil.ChartfileName {
+			return f.Data
+		}
+	}
+	t.Fatalf("no %s", chartutil.ChartfileName)
+	return nil
+}
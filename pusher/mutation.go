@@ -0,0 +1,253 @@
+package pusher
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/wahabmk/helm-pusher/pkg/random"
+	"gopkg.in/yaml.v2"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+const (
+	driftFile = "files/drift"
+	// minorBumpProbability is the probability that a dependency gets a minor instead of a patch release.
+	minorBumpProbability = 0.2
+)
+
+// Mutation has the probabilities, between 0 and 1, of each change that a version of a chart makes
+// to the content of the version before it. The first version of each chart has the content of the
+// template chart.
+type Mutation struct {
+	AddTemplate    float64
+	RemoveTemplate float64
+	ChangeValues   float64
+	// BumpDependencies releases a new patch or minor version of one of the subcharts.
+	BumpDependencies float64
+	// SizeDrift is the largest fraction by which the content of a version grows or shrinks relative
+	// to the version before it. Content never shrinks below that of the template chart.
+	SizeDrift float64
+}
+
+func (m Mutation) String() string {
+	return fmt.Sprintf("add template %.2f, remove template %.2f, change values %.2f, bump dependencies %.2f, size drift %.2f perc",
+		m.AddTemplate, m.RemoveTemplate, m.ChangeValues, m.BumpDependencies, m.SizeDrift*100)
+}
+
+// WithMutation changes the content of every version of a chart from the version before it with
+// the probabilities in m. Mutated versions are packaged without the packaging cache.
+func WithMutation(m Mutation) Option {
+	return func(o *options) {
+		o.mutation = &m
+	}
+}
+
+// mutationStats counts the changes made between versions.
+type mutationStats struct {
+	templatesAdded     int64
+	templatesRemoved   int64
+	valuesChanged      int64
+	dependenciesBumped int64
+	// grown and shrunk have how many bytes the content of each version grew or shrank by. Content
+	// that kept its size is counted as grown.
+	grown  histogram
+	shrunk histogram
+}
+
+func (m *mutationStats) merge(m2 *mutationStats) {
+	m.templatesAdded += m2.templatesAdded
+	m.templatesRemoved += m2.templatesRemoved
+	m.valuesChanged += m2.valuesChanged
+	m.dependenciesBumped += m2.dependenciesBumped
+	m.grown.merge(m2.grown)
+	m.shrunk.merge(m2.shrunk)
+}
+
+func (m *mutationStats) print(w io.Writer) {
+	if m.templatesAdded+m.templatesRemoved+m.valuesChanged+m.dependenciesBumped == 0 && len(m.grown)+len(m.shrunk) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "* Changes between versions: %d templates added, %d templates removed, %d values changed, %d dependencies bumped\n",
+		m.templatesAdded, m.templatesRemoved, m.valuesChanged, m.dependenciesBumped)
+	if len(m.grown)+len(m.shrunk) > 0 {
+		fmt.Fprintf(w, "* Content growth per version: %s\n", m.grown.summary(formatBytes))
+		fmt.Fprintf(w, "* Content shrinkage per version: %s\n", m.shrunk.summary(formatBytes))
+	}
+}
+
+// mutate changes the content of the chart from that of its previous version. The content of
+// the first version is copied from the template chart, along with its subcharts, which are
+// reparented when dependencies are bumped.
+func (r *routine) mutate(entropy *random.Entropy) error {
+	if r.history == nil {
+		r.history = copyChartTree(r.chart)
+	}
+	c := r.history
+	m := r.opts.mutation
+	chance := func(p float64) bool { return p > 0 && entropy.Float64() < p }
+
+	if chance(m.AddTemplate) {
+		name := fmt.Sprintf("revision-%x", entropy.Int63())
+		c.Templates = append(c.Templates[:len(c.Templates):len(c.Templates)], &chart.File{
+			Name: fmt.Sprintf("templates/%s.yaml", name),
+			Data: []byte(fmt.Sprintf(templateBody, name, entropy.Int63())),
+		})
+		r.stats.mutations.templatesAdded++
+	}
+	if chance(m.RemoveTemplate) && removeTemplate(entropy, c) {
+		r.stats.mutations.templatesRemoved++
+	}
+	if chance(m.ChangeValues) {
+		if err := changeValues(entropy, c); err != nil {
+			return fmt.Errorf("failed to change values: %w", err)
+		}
+		r.stats.mutations.valuesChanged++
+	}
+	if chance(m.BumpDependencies) && len(c.Metadata.Dependencies) > 0 {
+		if err := bumpDependency(entropy, c); err != nil {
+			return fmt.Errorf("failed to bump dependency: %w", err)
+		}
+		r.stats.mutations.dependenciesBumped++
+	}
+	if m.SizeDrift > 0 {
+		r.drift(entropy, c, m.SizeDrift)
+	}
+
+	return nil
+}
+
+// removeTemplate removes one of the manifest templates of c, unless it is the last one, and
+// reports whether it did.
+func removeTemplate(entropy *random.Entropy, c *chart.Chart) bool {
+	var candidates []int
+	for i, f := range c.Templates {
+		if path := strings.TrimPrefix(f.Name, "templates/"); !strings.Contains(path, "/") && strings.HasSuffix(path, ".yaml") {
+			candidates = append(candidates, i)
+		}
+	}
+	if len(candidates) < 2 {
+		return false
+	}
+
+	remove := candidates[entropy.Intn(len(candidates))]
+	templates := make([]*chart.File, 0, len(c.Templates)-1)
+	templates = append(templates, c.Templates[:remove]...)
+	c.Templates = append(templates, c.Templates[remove+1:]...)
+	return true
+}
+
+// changeValues sets one of the top level values of c, or a new one, to a random value, and
+// regenerates the values schema if c has one.
+func changeValues(entropy *random.Entropy, c *chart.Chart) error {
+	values := make(map[string]interface{}, len(c.Values)+1)
+	keys := make([]string, 0, len(c.Values))
+	for k, v := range c.Values {
+		values[k] = v
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	key := fmt.Sprintf("%s%d", fillerWords[entropy.Intn(len(fillerWords))], len(keys))
+	if len(keys) > 0 && entropy.Float64() < 0.7 {
+		key = keys[entropy.Intn(len(keys))]
+	}
+	values[key] = generateValue(entropy)
+
+	data, err := yaml.Marshal(values)
+	if err != nil {
+		return err
+	}
+	c.Values = values
+	c.Raw = withFile(c.Raw, &chart.File{Name: chartutil.ValuesfileName, Data: data})
+
+	if c.Schema != nil {
+		if c.Schema, err = json.MarshalIndent(generateSchema(c.Name(), c.Values), "", "  "); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bumpDependency releases a new version of one of the subcharts of c, and updates the dependency
+// on it and the lock of c.
+func bumpDependency(entropy *random.Entropy, c *chart.Chart) error {
+	deps := make([]*chart.Dependency, len(c.Metadata.Dependencies))
+	copy(deps, c.Metadata.Dependencies)
+
+	i := entropy.Intn(len(deps))
+	dep := *deps[i]
+	v, err := semver.NewVersion(dep.Version)
+	if err != nil {
+		return err
+	}
+	bumped := v.IncPatch()
+	if entropy.Float64() < minorBumpProbability {
+		bumped = v.IncMinor()
+	}
+	dep.Version = bumped.String()
+	deps[i] = &dep
+
+	subcharts := make([]*chart.Chart, 0, len(c.Dependencies()))
+	for _, sub := range c.Dependencies() {
+		if sub.Name() == dep.Name {
+			sub = copyChartTree(sub)
+			sub.Metadata.Version = dep.Version
+		}
+		subcharts = append(subcharts, sub)
+	}
+	c.SetDependencies(subcharts...)
+	c.Metadata.Dependencies = deps
+
+	if c.Lock != nil {
+		if c.Lock, err = lockFor(deps); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// drift grows or shrinks a file of c so that its content changes size by up to the given
+// fraction. Growing the file keeps its existing content, as a new version of a file would.
+func (r *routine) drift(entropy *random.Entropy, c *chart.Chart, fraction float64) {
+	var size int64
+	var data []byte
+	for _, files := range [][]*chart.File{c.Templates, c.Files, c.Raw} {
+		for _, f := range files {
+			size += int64(len(f.Data))
+			if f.Name == driftFile {
+				data = f.Data
+			}
+		}
+	}
+
+	n := int64(len(data)) + int64(float64(size)*fraction*(2*entropy.Float64()-1))
+	if n < 0 {
+		n = 0
+	}
+	change := n - int64(len(data))
+	if change >= 0 {
+		data = append(data[:len(data):len(data)], r.filler(entropy, change)...)
+		r.stats.mutations.grown.add(change)
+	} else {
+		data = data[:n]
+		r.stats.mutations.shrunk.add(-change)
+	}
+	c.Files = withFile(c.Files, &chart.File{Name: driftFile, Data: data})
+}
+
+// copyChartTree returns a copy of c, like copyChart, with copies of its subcharts, so that the
+// copy can be reparented without changing the parents of the subcharts of c.
+func copyChartTree(c *chart.Chart) *chart.Chart {
+	cp := copyChart(c)
+	subcharts := make([]*chart.Chart, 0, len(c.Dependencies()))
+	for _, sub := range c.Dependencies() {
+		subcharts = append(subcharts, copyChartTree(sub))
+	}
+	cp.SetDependencies(subcharts...)
+	return cp
+}
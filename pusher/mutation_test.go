@@ -0,0 +1,213 @@
+package pusher
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/wahabmk/helm-pusher/pkg/random"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+func TestRemoveTemplate(t *testing.T) {
+	template := scaffold(t)
+	names := func(c *chart.Chart) []string {
+		var names []string
+		for _, f := range c.Templates {
+			names = append(names, f.Name)
+		}
+		return names
+	}
+	before := strings.Join(names(template), ",")
+
+	c := copyChart(template)
+	entropy := random.New(1)
+	for removeTemplate(entropy, c) {
+	}
+
+	// Helpers, notes and tests are kept, along with one manifest.
+	var manifests int
+	for _, name := range names(c) {
+		switch {
+		case name == "templates/NOTES.txt", name == "templates/_helpers.tpl", strings.HasPrefix(name, "templates/tests/"):
+		case strings.HasSuffix(name, ".yaml"):
+			manifests++
+		default:
+			t.Errorf("unexpected template %s", name)
+		}
+	}
+	if manifests != 1 || len(c.Templates) != 4 {
+		t.Errorf("templates left are %v, want helpers, notes, tests and one manifest", names(c))
+	}
+	if after := strings.Join(names(template), ","); after != before {
+		t.Errorf("templates of the template chart changed from %s to %s", before, after)
+	}
+}
+
+func TestChangeValues(t *testing.T) {
+	r, _ := structuredChart(t, Structure{ValuesSize: 1 << 10, ValuesDepth: 2, Schema: true})
+	values, err := json.Marshal(r.chart.Values)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := copyChart(r.chart)
+	entropy := random.New(1)
+	for i := 0; i < 20; i++ {
+		if err := changeValues(entropy, c); err != nil {
+			t.Fatal(err)
+		}
+
+		// values.yaml has the changed values, which conform to the regenerated schema.
+		var raw *chart.File
+		for _, f := range c.Raw {
+			if f.Name == chartutil.ValuesfileName {
+				raw = f
+			}
+		}
+		loaded, err := chartutil.ReadValues(raw.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := json.Marshal(loaded)
+		want, _ := json.Marshal(c.Values)
+		if string(got) != string(want) {
+			t.Fatalf("values.yaml has %s, want %s", got, want)
+		}
+		if err := chartutil.ValidateAgainstSingleSchema(c.Values, c.Schema); err != nil {
+			t.Fatalf("changed values do not conform to their schema: %v", err)
+		}
+	}
+
+	if changed, _ := json.Marshal(c.Values); string(changed) == string(values) {
+		t.Error("values were not changed")
+	}
+	if after, _ := json.Marshal(r.chart.Values); string(after) != string(values) {
+		t.Error("values of the template chart changed")
+	}
+}
+
+func TestBumpDependency(t *testing.T) {
+	s := Structure{Subcharts: 3, SubchartDepth: 2, Lock: true}
+	r, _ := structuredChart(t, s)
+	template := r.chart
+	versions := map[string]string{}
+	for _, dep := range template.Metadata.Dependencies {
+		versions[dep.Name] = dep.Version
+	}
+
+	r.opts.mutation = &Mutation{BumpDependencies: 1}
+	entropy := random.New(1)
+	previous := map[string]*semver.Version{}
+	for _, dep := range template.Metadata.Dependencies {
+		previous[dep.Name] = semver.MustParse(dep.Version)
+	}
+	for i := 0; i < 10; i++ {
+		if err := r.mutate(entropy); err != nil {
+			t.Fatal(err)
+		}
+
+		bumped := 0
+		for _, dep := range r.history.Metadata.Dependencies {
+			v := semver.MustParse(dep.Version)
+			if v.GreaterThan(previous[dep.Name]) {
+				bumped++
+			} else if !v.Equal(previous[dep.Name]) {
+				t.Errorf("%s went from %s to %s", dep.Name, previous[dep.Name], v)
+			}
+			previous[dep.Name] = v
+		}
+		if bumped != 1 {
+			t.Errorf("%d dependencies were bumped, want 1", bumped)
+		}
+	}
+	if r.stats.mutations.dependenciesBumped != 10 {
+		t.Errorf("%d dependencies bumped, want 10", r.stats.mutations.dependenciesBumped)
+	}
+
+	// The subcharts and lock of the chart match its dependencies.
+	buf, err := r.opts.packager.Package(r.history)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loader.LoadArchive(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStructure(t, s, loaded, s.SubchartDepth)
+	for _, sub := range loaded.Dependencies() {
+		for _, dep := range loaded.Metadata.Dependencies {
+			if dep.Name == sub.Name() && dep.Version != sub.Metadata.Version {
+				t.Errorf("%s depends on %s %s, but has version %s", loaded.Name(), dep.Name, dep.Version, sub.Metadata.Version)
+			}
+		}
+	}
+
+	// The template chart keeps its versions, and its subcharts their parents.
+	for _, dep := range template.Metadata.Dependencies {
+		if dep.Version != versions[dep.Name] {
+			t.Errorf("template chart depends on %s %s, want %s", dep.Name, dep.Version, versions[dep.Name])
+		}
+	}
+	var checkParents func(c *chart.Chart)
+	checkParents = func(c *chart.Chart) {
+		for _, sub := range c.Dependencies() {
+			if sub.Parent() != c {
+				t.Errorf("%s of the template chart was reparented", sub.ChartFullPath())
+			}
+			if sub.Metadata.Version != subchartVersion {
+				t.Errorf("%s of the template chart has version %s, want %s", sub.ChartFullPath(), sub.Metadata.Version, subchartVersion)
+			}
+			checkParents(sub)
+		}
+	}
+	checkParents(template)
+}
+
+func TestDrift(t *testing.T) {
+	const fraction = 0.1
+	r := newTestRoutine(t, scaffold(t), 1, WithMutation(Mutation{SizeDrift: fraction}))
+	c := copyChart(r.chart)
+	size := func() int64 {
+		var size int64
+		for _, files := range [][]*chart.File{c.Templates, c.Files, c.Raw} {
+			for _, f := range files {
+				size += int64(len(f.Data))
+			}
+		}
+		return size
+	}
+	base := size()
+
+	entropy := random.New(1)
+	for i := 0; i < 200; i++ {
+		before := size()
+		r.drift(entropy, c, fraction)
+		after := size()
+		if after < base {
+			t.Fatalf("content shrank to %d bytes, below the %d bytes of the template chart", after, base)
+		}
+		if change := after - before; change > int64(float64(before)*fraction) || change < -int64(float64(before)*fraction) {
+			t.Fatalf("content changed from %d to %d bytes, want a change of up to %.0f perc", before, after, fraction*100)
+		}
+	}
+
+	// The drift recorded adds up to the size of the drift file.
+	m := r.stats.mutations
+	if len(m.grown) == 0 || len(m.shrunk) == 0 || len(m.grown)+len(m.shrunk) != 200 {
+		t.Errorf("content grew %d and shrank %d times, want both in 200 changes", len(m.grown), len(m.shrunk))
+	}
+	var drift int64
+	for _, n := range m.grown {
+		drift += n
+	}
+	for _, n := range m.shrunk {
+		drift -= n
+	}
+	if drift != size()-base {
+		t.Errorf("content drifted by %d bytes, but grew by %d", drift, size()-base)
+	}
+}
@@ -0,0 +1,244 @@
+package pusher
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wahabmk/helm-pusher/pkg/random"
+)
+
+const (
+	// nameAttempts is how many times a namer tries to come up with an unused name before it
+	// gives up and adds a numeric suffix.
+	nameAttempts = 10
+	// nameHistory is how many previously generated names a CollidingNamer can pick from.
+	nameHistory = 10000
+)
+
+// Namer generates chart names. Namers are shared by all routines so they must be safe for
+// concurrent use, but they are given the entropy of the calling routine.
+type Namer interface {
+	Name(entropy *random.Entropy) (string, error)
+	String() string
+}
+
+// ParseNamer returns the naming strategy described by s, which is one of:
+//
+//	ulid
+//	words:<number of words>
+//	list:<file with one name per line>
+func ParseNamer(s string) (Namer, error) {
+	parts := strings.SplitN(s, ":", 2)
+	switch {
+	case parts[0] == "ulid" && len(parts) == 1:
+		return ULIDNamer{}, nil
+	case parts[0] == "words" && len(parts) == 2:
+		n, err := strconv.Atoi(parts[1])
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid number of words %q", parts[1])
+		}
+		return NewWordNamer(n), nil
+	case parts[0] == "list" && len(parts) == 2:
+		return LoadListNamer(parts[1])
+	default:
+		return nil, fmt.Errorf("unknown naming strategy %q", s)
+	}
+}
+
+// NewRunID returns a short identifier that is unique to each run and valid in chart names.
+func NewRunID() string {
+	return "run" + strconv.FormatInt(time.Now().Unix(), 36)
+}
+
+// ULIDNamer names charts with a ULID, which is unique but not a conventional chart name.
+type ULIDNamer struct{}
+
+func (ULIDNamer) Name(entropy *random.Entropy) (string, error) {
+	return entropy.String()
+}
+
+func (ULIDNamer) String() string {
+	return "ULIDs"
+}
+
+// WordNamer names charts with lowercase words separated by hyphens, e.g. "brave-otter".
+// The last word is a noun and the words before it are adjectives.
+type WordNamer struct {
+	words int
+	used  *nameSet
+}
+
+func NewWordNamer(words int) *WordNamer {
+	return &WordNamer{words: words, used: newNameSet()}
+}
+
+func (w *WordNamer) Name(entropy *random.Entropy) (string, error) {
+	return w.used.unique(func() string {
+		parts := make([]string, w.words)
+		for i := 0; i < w.words-1; i++ {
+			parts[i] = random.Adjectives[entropy.Intn(len(random.Adjectives))]
+		}
+		parts[w.words-1] = random.Nouns[entropy.Intn(len(random.Nouns))]
+		return strings.Join(parts, "-")
+	}), nil
+}
+
+func (w *WordNamer) String() string {
+	return fmt.Sprintf("%d hyphenated words", w.words)
+}
+
+// ListNamer names charts with names sampled, without replacement, from a list. Once every
+// name has been used the names are reused with a numeric suffix.
+type ListNamer struct {
+	names []string
+	used  *nameSet
+	// remaining has the names that have not been sampled yet. It is guarded by the lock of used.
+	remaining []string
+}
+
+func NewListNamer(names []string) (*ListNamer, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("list of names is empty")
+	}
+	return &ListNamer{names: names, used: newNameSet(), remaining: append([]string{}, names...)}, nil
+}
+
+// LoadListNamer reads the names for a ListNamer from a file with one name per line.
+func LoadListNamer(path string) (*ListNamer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var names []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if name := strings.TrimSpace(scanner.Text()); name != "" && !strings.HasPrefix(name, "#") {
+			names = append(names, name)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read names from %q: %w", path, err)
+	}
+
+	return NewListNamer(names)
+}
+
+func (l *ListNamer) Name(entropy *random.Entropy) (string, error) {
+	return l.used.unique(func() string {
+		if len(l.remaining) == 0 {
+			return l.names[entropy.Intn(len(l.names))]
+		}
+		i, last := entropy.Intn(len(l.remaining)), len(l.remaining)-1
+		name := l.remaining[i]
+		l.remaining[i] = l.remaining[last]
+		l.remaining = l.remaining[:last]
+		return name
+	}), nil
+}
+
+func (l *ListNamer) String() string {
+	return fmt.Sprintf("sampled from a list of %d names", len(l.names))
+}
+
+// PrefixNamer prefixes the names of another namer, e.g. with a run ID so that charts pushed
+// by different runs never clash.
+type PrefixNamer struct {
+	Prefix string
+	Namer  Namer
+}
+
+func (p PrefixNamer) Name(entropy *random.Entropy) (string, error) {
+	name, err := p.Namer.Name(entropy)
+	if err != nil {
+		return "", err
+	}
+	return p.Prefix + "-" + name, nil
+}
+
+func (p PrefixNamer) String() string {
+	return fmt.Sprintf("%s, prefixed with %q", p.Namer, p.Prefix)
+}
+
+// CollidingNamer deliberately reuses a previously generated name with the given probability,
+// so that different charts end up overlapping.
+type CollidingNamer struct {
+	Namer       Namer
+	Probability float64
+
+	mu      sync.Mutex
+	history []string
+	// next is where the next name is recorded once the history is full.
+	next int
+}
+
+func (c *CollidingNamer) Name(entropy *random.Entropy) (string, error) {
+	c.mu.Lock()
+	if len(c.history) > 0 && entropy.Float64() < c.Probability {
+		name := c.history[entropy.Intn(len(c.history))]
+		c.mu.Unlock()
+		return name, nil
+	}
+	c.mu.Unlock()
+
+	name, err := c.Namer.Name(entropy)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.history) < nameHistory {
+		c.history = append(c.history, name)
+	} else {
+		c.history[c.next] = name
+		c.next = (c.next + 1) % nameHistory
+	}
+	return name, nil
+}
+
+func (c *CollidingNamer) String() string {
+	return fmt.Sprintf("%s, with %.2f perc collisions", c.Namer, c.Probability*100)
+}
+
+// nameSet keeps track of the names that have been handed out.
+type nameSet struct {
+	mu   sync.Mutex
+	used map[string]int
+}
+
+func newNameSet() *nameSet {
+	return &nameSet{used: map[string]int{}}
+}
+
+// unique calls generate until it returns an unused name. If that does not happen within a few
+// attempts, a numeric suffix is added to the last generated name to make it unique. generate is
+// called with the lock of s held.
+func (s *nameSet) unique(generate func() string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var name string
+	for i := 0; i < nameAttempts; i++ {
+		name = generate()
+		if _, ok := s.used[name]; !ok {
+			s.used[name] = 1
+			return name
+		}
+	}
+
+	for {
+		s.used[name]++
+		suffixed := fmt.Sprintf("%s-%d", name, s.used[name])
+		if _, ok := s.used[suffixed]; !ok {
+			s.used[suffixed] = 1
+			return suffixed
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package pusher
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/wahabmk/helm-pusher/pkg/random"
+)
+
+func TestWordNamer(t *testing.T) {
+	adjectives, nouns := map[string]bool{}, map[string]bool{}
+	for _, w := range random.Adjectives {
+		adjectives[w] = true
+	}
+	for _, w := range random.Nouns {
+		nouns[w] = true
+	}
+
+	n := NewWordNamer(3)
+	entropy := random.New(1)
+	names := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		name, err := n.Name(entropy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if names[name] {
+			t.Fatalf("%s was generated twice", name)
+		}
+		names[name] = true
+
+		words := strings.Split(name, "-")
+		if len(words) != 3 || !adjectives[words[0]] || !adjectives[words[1]] || !nouns[words[2]] {
+			t.Errorf("%s is not two adjectives and a noun", name)
+		}
+	}
+}
+
+func TestListNamer(t *testing.T) {
+	n, err := NewListNamer([]string{"a", "b", "c", "d", "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entropy := random.New(1)
+	var names []string
+	for i := 0; i < 8; i++ {
+		name, err := n.Name(entropy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+
+	// Every name in the list is sampled before any is reused, and names are unique.
+	first := append([]string{}, names[:4]...)
+	sort.Strings(first)
+	if strings.Join(first, ",") != "a,b,c,d" {
+		t.Errorf("first names are %v, want each name in the list", names[:4])
+	}
+	seen := map[string]bool{}
+	for i, name := range names {
+		if seen[name] {
+			t.Errorf("%s was generated twice in %v", name, names)
+		}
+		seen[name] = true
+		if suffix := strings.LastIndex(name, "-"); i >= 4 && (suffix < 0 || !strings.Contains("abcd", name[:suffix])) {
+			t.Errorf("%s is not a reused name with a suffix", name)
+		}
+	}
+
+	if _, err := NewListNamer(nil); err == nil {
+		t.Error("empty list of names was accepted")
+	}
+}
+
+// failingNamer fails to generate names.
+type failingNamer struct{}
+
+func (failingNamer) Name(*random.Entropy) (string, error) {
+	return "", errors.New("no names")
+}
+
+func (failingNamer) String() string {
+	return "failing"
+}
+
+func TestPrefixNamer(t *testing.T) {
+	list, err := NewListNamer([]string{"chart"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := PrefixNamer{Prefix: "run1", Namer: list}
+	for _, want := range []string{"run1-chart", "run1-chart-2"} {
+		if name, err := p.Name(random.New(1)); err != nil || name != want {
+			t.Errorf("name is %q, %v, want %q", name, err, want)
+		}
+	}
+
+	if _, err := (PrefixNamer{Prefix: "run1", Namer: failingNamer{}}).Name(random.New(1)); err == nil {
+		t.Error("error of the prefixed namer was not returned")
+	}
+}
+
+func TestCollidingNamer(t *testing.T) {
+	const names = 10000
+	for _, probability := range []float64{0, 0.3, 1} {
+		c := &CollidingNamer{Namer: NewWordNamer(3), Probability: probability}
+		entropy := random.New(1)
+		seen := map[string]bool{}
+		collisions := 0
+		for i := 0; i < names; i++ {
+			name, err := c.Name(entropy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if seen[name] {
+				collisions++
+			}
+			seen[name] = true
+		}
+
+		// The first name cannot collide.
+		want := probability * (names - 1)
+		if got := float64(collisions); got < want-200 || got > want+200 {
+			t.Errorf("%d of %d names collided with a probability of %.1f, want about %.0f", collisions, names, probability, want)
+		}
+	}
+
+	// Only the latest names are picked from once the history is full.
+	c := &CollidingNamer{Namer: NewWordNamer(3)}
+	entropy := random.New(1)
+	var last string
+	for i := 0; i < nameHistory+5; i++ {
+		name, err := c.Name(entropy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		last = name
+	}
+	if len(c.history) != nameHistory || c.history[4] != last || c.next != 5 {
+		t.Errorf("history has %d names, next is %d and %q is at 4, want %d, 5 and %q", len(c.history), c.next, c.history[4], nameHistory, last)
+	}
+
+	c = &CollidingNamer{Namer: failingNamer{}, Probability: 0.5}
+	if _, err := c.Name(random.New(1)); err == nil {
+		t.Error("error of the colliding namer was not returned")
+	}
+}
+
+func TestParseNamer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "naming-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	list := filepath.Join(dir, "names")
+	if err := ioutil.WriteFile(list, []byte("# charts\nnginx\n\n  redis  \n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"ulid", "ULIDs"},
+		{"words:2", "2 hyphenated words"},
+		{"list:" + list, "sampled from a list of 2 names"},
+		{"ulid:1", ""},
+		{"words", ""},
+		{"words:0", ""},
+		{"words:x", ""},
+		{"list:" + filepath.Join(dir, "missing"), ""},
+		{"uuid", ""},
+	}
+	for _, tt := range tests {
+		n, err := ParseNamer(tt.s)
+		if got := fmt.Sprint(n); tt.want == "" && err == nil || tt.want != "" && (err != nil || got != tt.want) {
+			t.Errorf("ParseNamer(%q) = %s, %v, want %q", tt.s, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package pusher
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	helmConfigMediaType  = "application/vnd.cncf.helm.config.v1+json"
+	helmLayerMediaType   = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+)
+
+// OCI pushes charts as OCI artifacts, the way `helm push` does, to a registry that implements the
+// distribution API at URL, such as https://registry.example.com. Each chart is pushed to the
+// repository <Namespace>/<name>, with its name in lower case, and is tagged with its version.
+// Username and Password are sent with basic auth, or exchanged for bearer tokens when the
+// registry challenges for them.
+type OCI struct {
+	URL       string
+	Namespace string
+	Username  string
+	Password  string
+	// ChunkSize, if greater than 0, uploads blobs in PATCH requests of up to ChunkSize bytes
+	// instead of in a single PUT.
+	ChunkSize int64
+	// Copies also pushes each chart to this many other namespaces, <Namespace>-copy1 and so on,
+	// like charts that are promoted from one namespace to the next.
+	Copies int
+	// Mount mounts blobs that were pushed to another repository before, such as the repository
+	// that a copy is made from, from that repository instead of uploading them again.
+	Mount bool
+
+	// blobsUploaded and blobsExisting count the blobs that were uploaded, and that were not
+	// because the registry already had them.
+	blobsUploaded int64
+	blobsExisting int64
+	// mountsAccepted and mountsDeclined count the mounts that the registry made, and those that it
+	// started a regular upload for instead.
+	mountsAccepted int64
+	mountsDeclined int64
+
+	// mu guards sources, which has the repository that each blob was last pushed to when Mount is set.
+	mu      sync.Mutex
+	sources map[string]string
+
+	tokens tokens
+}
+
+// NewOCI returns an OCI target for the registry at u.
+func NewOCI(u, namespace, username, password string) *OCI {
+	return &OCI{URL: strings.TrimSuffix(u, "/"), Namespace: namespace, Username: username, Password: password}
+}
+
+func (t *OCI) String() string {
+	s := fmt.Sprintf("OCI registry %s/%s", t.URL, t.Namespace)
+	if t.ChunkSize > 0 {
+		s += fmt.Sprintf(", uploading blobs in chunks of %s", formatBytes(t.ChunkSize))
+	}
+	if t.Copies > 0 {
+		s += fmt.Sprintf(", with %d copies of each chart", t.Copies)
+	}
+	if t.Mount {
+		s += ", mounting blobs from other repositories"
+	}
+	return s
+}
+
+// ociDescriptor describes a blob that a manifest refers to.
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+type ociManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Config        ociDescriptor   `json:"config"`
+	Layers        []ociDescriptor `json:"layers"`
+}
+
+// Push uploads the config and chart blobs, unless the registry already has them, and then the
+// manifest that refers to them, to the repository of the chart and to each of its copies. The
+// chart is read into memory, since its digest is needed first.
+func (t *OCI) Push(do Doer, name, version string, body io.Reader, _ int64) error {
+	var layer []byte
+	if b, ok := body.(interface{ Bytes() []byte }); ok {
+		layer = b.Bytes()
+	} else {
+		var err error
+		if layer, err = ioutil.ReadAll(body); err != nil {
+			return err
+		}
+	}
+
+	config, err := chartConfig(layer)
+	if err != nil {
+		return fmt.Errorf("failed to read chart metadata: %w", err)
+	}
+
+	m := ociManifest{
+		SchemaVersion: 2,
+		MediaType:     ociManifestMediaType,
+		Config:        ociDescriptor{MediaType: helmConfigMediaType, Digest: ociDigest(config), Size: int64(len(config))},
+		Layers:        []ociDescriptor{{MediaType: helmLayerMediaType, Digest: ociDigest(layer), Size: int64(len(layer))}},
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i <= t.Copies; i++ {
+		repo := path.Join(t.namespace(i), strings.ToLower(name))
+		if err := t.pushManifest(t.authorized(do, repo), repo, ociTag(version), data, m, config, layer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pushManifest pushes the blobs of m, and then m itself, to repo.
+func (t *OCI) pushManifest(do Doer, repo, tag string, data []byte, m ociManifest, config, layer []byte) error {
+	if err := t.pushBlob(do, repo, m.Config.Digest, config); err != nil {
+		return err
+	}
+	if err := t.pushBlob(do, repo, m.Layers[0].Digest, layer); err != nil {
+		return err
+	}
+
+	req, err := t.newRequest(http.MethodPut, t.endpoint(repo, "manifests", tag), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", ociManifestMediaType)
+	return expect(do, req, http.StatusCreated)
+}
+
+// Report writes how many blobs were uploaded and mounted, and the stats of the token server, to w.
+func (t *OCI) Report(w io.Writer) {
+	uploaded, existing := atomic.LoadInt64(&t.blobsUploaded), atomic.LoadInt64(&t.blobsExisting)
+	fmt.Fprintf(w, "* OCI blobs: %d uploaded, %d already existed (%.2f perc)\n",
+		uploaded, existing, percent(existing, uploaded+existing))
+	if t.Mount {
+		accepted, declined := atomic.LoadInt64(&t.mountsAccepted), atomic.LoadInt64(&t.mountsDeclined)
+		fmt.Fprintf(w, "* OCI blob mounts: %d of %d accepted (%.2f perc)\n",
+			accepted, accepted+declined, percent(accepted, accepted+declined))
+	}
+	t.tokens.report(w)
+}
+
+// namespace returns Namespace for i 0, and the namespace of copy i otherwise.
+func (t *OCI) namespace(i int) string {
+	switch {
+	case i == 0:
+		return t.Namespace
+	case t.Namespace == "":
+		return fmt.Sprintf("copy%d", i)
+	default:
+		return fmt.Sprintf("%s-copy%d", t.Namespace, i)
+	}
+}
+
+// endpoint returns the URL of a distribution API endpoint of repo.
+func (t *OCI) endpoint(repo, kind, reference string) string {
+	return fmt.Sprintf("%s/v2/%s/%s/%s", t.URL, repo, kind, reference)
+}
+
+func (t *OCI) newRequest(method, u string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if t.Username != "" || t.Password != "" {
+		req.SetBasicAuth(t.Username, t.Password)
+	}
+	return req, nil
+}
+
+func (t *OCI) getJSON(do Doer, req *http.Request, v interface{}) error {
+	resp, err := do.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &statusError{code: resp.StatusCode}
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// chartConfig returns the config blob of a chart package, which is its metadata in JSON.
+func chartConfig(pkg []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(pkg))
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(zr)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no %s", chartutil.ChartfileName)
+		}
+		if err != nil {
+			return nil, err
+		}
+		// The Chart.yaml of the chart, rather than of one of its subcharts, is the first one.
+		if path.Base(h.Name) != chartutil.ChartfileName {
+			continue
+		}
+
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		md := &chart.Metadata{}
+		if err := yaml.Unmarshal(data, md); err != nil {
+			return nil, err
+		}
+		return json.Marshal(md)
+	}
+}
+
+func ociDigest(data []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
+
+// ociTag returns the tag of a chart version. Tags cannot contain "+", which Helm replaces with "_".
+func ociTag(version string) string {
+	return strings.Replace(version, "+", "_", -1)
+}
@@ -0,0 +1,221 @@
+package pusher
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/wahabmk/helm-pusher/pkg/helm"
+)
+
+// ociRegistry is a registry that implements the parts of the distribution API that OCI uses. It
+// rebuilds blobs from their uploads and rejects those that do not match their digest.
+type ociRegistry struct {
+	*httptest.Server
+	// declineMounts answers requests to mount blobs by starting a regular upload.
+	declineMounts bool
+	// fail answers the requests of each kind, such as "PUT manifest", with a status.
+	fail map[string]int
+
+	mu        sync.Mutex
+	blobs     map[string][]byte
+	uploads   map[string][]byte
+	manifests map[string][]byte
+	// requests has the kind of each request, and errs what was wrong with requests.
+	requests []string
+	errs     []string
+}
+
+func newOCIRegistry() *ociRegistry {
+	reg := &ociRegistry{blobs: map[string][]byte{}, uploads: map[string][]byte{}, manifests: map[string][]byte{}}
+	reg.Server = httptest.NewServer(http.HandlerFunc(reg.serve))
+	return reg
+}
+
+// route splits the path of a distribution API request into its repository, the kind of the
+// endpoint and the reference that follows it.
+func route(p string) (repo, kind, reference string) {
+	p = strings.TrimPrefix(p, "/v2/")
+	for _, k := range []string{"/blobs/uploads/", "/blobs/", "/manifests/"} {
+		if i := strings.LastIndex(p, k); i >= 0 {
+			return p[:i], strings.Trim(k, "/"), p[i+len(k):]
+		}
+	}
+	return p, "", ""
+}
+
+func (reg *ociRegistry) serve(w http.ResponseWriter, req *http.Request) {
+	repo, kind, reference := route(req.URL.Path)
+	body, _ := ioutil.ReadAll(req.Body)
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	request := req.Method + " " + kind
+	reg.requests = append(reg.requests, request)
+	if status, ok := reg.fail[request]; ok {
+		w.WriteHeader(status)
+		return
+	}
+
+	switch request {
+	case "HEAD blobs":
+		if _, ok := reg.blobs[repo+"@"+reference]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case "POST blobs/uploads":
+		q := req.URL.Query()
+		if blob, ok := reg.blobs[q.Get("from")+"@"+q.Get("mount")]; ok && !reg.declineMounts {
+			reg.blobs[repo+"@"+q.Get("mount")] = blob
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		id := strconv.Itoa(len(reg.uploads))
+		reg.uploads[id] = nil
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%s", repo, id))
+		w.WriteHeader(http.StatusAccepted)
+	case "PATCH blobs/uploads":
+		upload := reg.uploads[reference]
+		if want := fmt.Sprintf("%d-%d", len(upload), len(upload)+len(body)-1); req.Header.Get("Content-Range") != want {
+			reg.errs = append(reg.errs, fmt.Sprintf("chunk has range %s, want %s", req.Header.Get("Content-Range"), want))
+		}
+		reg.uploads[reference] = append(upload, body...)
+		w.Header().Set("Location", req.URL.Path)
+		w.Header().Set("Range", fmt.Sprintf("0-%d", len(reg.uploads[reference])-1))
+		w.WriteHeader(http.StatusAccepted)
+	case "PUT blobs/uploads":
+		blob := append(reg.uploads[reference], body...)
+		digest := req.URL.Query().Get("digest")
+		if fmt.Sprintf("sha256:%x", sha256.Sum256(blob)) != digest {
+			reg.errs = append(reg.errs, fmt.Sprintf("blob of %d bytes does not match %s", len(blob), digest))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		delete(reg.uploads, reference)
+		reg.blobs[repo+"@"+digest] = blob
+		w.WriteHeader(http.StatusCreated)
+	case "PUT manifests":
+		m := ociManifest{}
+		if err := json.Unmarshal(body, &m); err != nil {
+			reg.errs = append(reg.errs, fmt.Sprintf("invalid manifest: %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, d := range append([]ociDescriptor{m.Config}, m.Layers...) {
+			if blob, ok := reg.blobs[repo+"@"+d.Digest]; !ok || int64(len(blob)) != d.Size {
+				reg.errs = append(reg.errs, fmt.Sprintf("manifest of %s refers to %s, which it does not have", repo, d.Digest))
+			}
+		}
+		reg.manifests[repo+":"+reference] = body
+		w.WriteHeader(http.StatusCreated)
+	default:
+		reg.errs = append(reg.errs, "unexpected request "+req.Method+" "+req.URL.Path)
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// take returns the requests sent since it was last called, and fails t with the errors found.
+func (reg *ociRegistry) take(t *testing.T) []string {
+	t.Helper()
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	for _, err := range reg.errs {
+		t.Error(err)
+	}
+	requests := reg.requests
+	reg.requests, reg.errs = nil, nil
+	return requests
+}
+
+// ociChart returns the package of the scaffold with the given name and version.
+func ociChart(t *testing.T, name, version string) []byte {
+	t.Helper()
+	c := scaffold(t)
+	c.Metadata.Name, c.Metadata.Version = name, version
+	buf, err := helm.PackageChart(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestOCIPush(t *testing.T) {
+	reg := newOCIRegistry()
+	defer reg.Close()
+	target := NewOCI(reg.URL, "charts", "", "")
+
+	pkg := ociChart(t, "Chart", "1.0.0+build.1")
+	if err := target.Push(httpClient, "Chart", "1.0.0+build.1", bytes.NewReader(pkg), int64(len(pkg))); err != nil {
+		t.Fatal(err)
+	}
+	upload := []string{"HEAD blobs", "POST blobs/uploads", "PUT blobs/uploads"}
+	want := append(append(append([]string{}, upload...), upload...), "PUT manifests")
+	if got := reg.take(t); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests are %v, want %v", got, want)
+	}
+
+	data, ok := reg.manifests["charts/chart:1.0.0_build.1"]
+	if !ok {
+		t.Fatalf("no manifest tagged 1.0.0_build.1 in charts/chart, got %v", reg.manifests)
+	}
+	m := ociManifest{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Layers) != 1 || m.Layers[0].Digest != fmt.Sprintf("sha256:%x", sha256.Sum256(pkg)) || m.Layers[0].MediaType != helmLayerMediaType {
+		t.Errorf("manifest has layers %+v, want the chart", m.Layers)
+	}
+	config := struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}{}
+	if err := json.Unmarshal(reg.blobs["charts/chart@"+m.Config.Digest], &config); err != nil || config.Name != "Chart" || config.Version != "1.0.0+build.1" {
+		t.Errorf("config is %+v (%v), want the metadata of the chart", config, err)
+	}
+
+	// Blobs that the registry has are not uploaded again.
+	if err := target.Push(httpClient, "Chart", "1.0.0+build.1", bytes.NewReader(pkg), int64(len(pkg))); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := reg.take(t), []string{"HEAD blobs", "HEAD blobs", "PUT manifests"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("requests are %v, want %v", got, want)
+	}
+	if target.blobsUploaded != 2 || target.blobsExisting != 2 {
+		t.Errorf("%d blobs uploaded and %d existing, want 2 and 2", target.blobsUploaded, target.blobsExisting)
+	}
+}
+
+func TestOCIPushReportsStatus(t *testing.T) {
+	tests := []struct {
+		request string
+		status  int
+	}{
+		{"HEAD blobs", http.StatusInternalServerError},
+		{"POST blobs/uploads", http.StatusForbidden},
+		{"PUT blobs/uploads", http.StatusBadRequest},
+		{"PUT manifests", http.StatusOK},
+	}
+	pkg := ociChart(t, "chart", "0.1.0")
+	for _, tt := range tests {
+		t.Run(tt.request, func(t *testing.T) {
+			reg := newOCIRegistry()
+			defer reg.Close()
+			reg.fail = map[string]int{tt.request: tt.status}
+
+			err := NewOCI(reg.URL, "charts", "", "").Push(httpClient, "chart", "0.1.0", bytes.NewReader(pkg), int64(len(pkg)))
+			var se *statusError
+			if !errors.As(err, &se) || se.code != tt.status {
+				t.Errorf("push returned %v, want status %d", err, tt.status)
+			}
+		})
+	}
+}
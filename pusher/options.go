@@ -0,0 +1,112 @@
+package pusher
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/wahabmk/helm-pusher/pkg/helm"
+	"github.com/wahabmk/helm-pusher/pkg/random"
+)
+
+// Option configures optional behavior of the Pusher.
+type Option func(*options)
+
+// options are shared, read-only, by all routines.
+type options struct {
+	packageSize  random.Distribution
+	compressible bool
+	structure    *Structure
+	namer        Namer
+	versioner    Versioner
+	// versionsPerChart replaces the uniform number of versions of each chart when set.
+	versionsPerChart random.Distribution
+	metadata         *MetadataProbabilities
+	// legacy is the fraction of charts generated with apiVersion v1.
+	legacy float64
+	// hostile is the fraction of pushes that are replaced by one of the hostileCases.
+	hostile      float64
+	hostileCases []hostileCase
+	// unknownHostileCases has the case names given to WithHostileCharts that are not hostileCases.
+	unknownHostileCases []string
+	packager            *helm.Packager
+	// streaming packages charts into request bodies, with a precomputed length if streamSized is set.
+	streaming   bool
+	streamSized bool
+	// cache packages charts from a helm.Template of the template chart.
+	cache bool
+	// originalOrder pushes directories of chart archives by modification time, paced if replaySpeedup is set.
+	originalOrder bool
+	replaySpeedup float64
+	// corpusRetries is how many times a chart from a corpus is pushed again when failures are repeated.
+	corpusRetries int
+	mutation      *Mutation
+	target        Target
+}
+
+func defaultOptions() options {
+	return options{
+		namer:         ULIDNamer{},
+		versioner:     RandomVersioner{},
+		packager:      &helm.Packager{},
+		corpusRetries: defaultCorpusRetries,
+	}
+}
+
+// WithNamer names charts using n instead of ULIDs.
+func WithNamer(n Namer) Option {
+	return func(o *options) {
+		o.namer = n
+	}
+}
+
+// WithPackageSize pads every chart with a filler file so that its packaged size matches a value
+// sampled from dist. Compressible filler is text that gzip shrinks considerably, otherwise the
+// filler is random bytes that do not compress at all.
+func WithPackageSize(dist random.Distribution, compressible bool) Option {
+	return func(o *options) {
+		o.packageSize = dist
+		o.compressible = compressible
+	}
+}
+
+// WithVersioner generates the versions of each chart using v instead of random versions.
+func WithVersioner(v Versioner) Option {
+	return func(o *options) {
+		o.versioner = v
+	}
+}
+
+// WithVersionsPerChart samples the number of versions of each chart from dist instead of
+// picking a uniformly random number up to nVersions.
+func WithVersionsPerChart(dist random.Distribution) Option {
+	return func(o *options) {
+		o.versionsPerChart = dist
+	}
+}
+
+// WithPackaging writes chart archives in the given mode instead of helm.Default.
+func WithPackaging(mode helm.Mode) Option {
+	return func(o *options) {
+		o.packager = &helm.Packager{Mode: mode}
+	}
+}
+
+// validate returns an error if options cannot be combined.
+func (o *options) validate() error {
+	if o.streaming && o.streamSized && o.packager.Mode != helm.Reproducible {
+		return errStreamSize
+	}
+	if o.cache && o.packageSize != nil {
+		return errCacheSize
+	}
+	if v, ok := o.target.(interface{ validate() error }); ok {
+		if err := v.validate(); err != nil {
+			return err
+		}
+	}
+	if len(o.unknownHostileCases) > 0 {
+		return fmt.Errorf("unknown hostile cases %s, expected any of %s",
+			strings.Join(o.unknownHostileCases, ", "), strings.Join(HostileCases(), ", "))
+	}
+	return nil
+}
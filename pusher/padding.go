@@ -0,0 +1,106 @@
+package pusher
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/wahabmk/helm-pusher/pkg/random"
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+const (
+	fillerFile = "files/filler"
+	// paddingAttempts is the number of times a chart is re-packaged to get closer to the target size.
+	paddingAttempts = 4
+	// paddingTolerance is the fraction of the target size by which the packaged size may differ.
+	paddingTolerance = 0.01
+	// minPaddingTolerance is how much the packaged size may differ for small targets.
+	minPaddingTolerance = 512
+)
+
+var (
+	fillerWords = []string{"alpha", "bravo", "charlie", "delta", "echo", "foxtrot", "golf", "hotel", "india", "juliet"}
+)
+
+// packagePadded adds a filler file to c so that its packaged size is close to target,
+// and returns the package and its size. Charts that are already larger than target are not padded.
+//
+// The size of the filler is corrected after each packaging attempt, using the compression
+// ratio of the filler observed so far.
+func (r *routine) packagePadded(entropy *random.Entropy, c *chart.Chart, target int64) (*bytes.Buffer, int64, error) {
+	base := make([]*chart.File, 0, len(c.Files))
+	for _, f := range c.Files {
+		if f.Name != fillerFile {
+			base = append(base, f)
+		}
+	}
+	c.Files = base
+
+	buf, size, err := r.measure(r.opts.packager, c)
+	if err != nil || size >= target {
+		return buf, size, err
+	}
+	baseSize := size
+
+	if r.fillerRatio <= 0 {
+		r.fillerRatio = 1
+	}
+	tolerance := int64(float64(target) * paddingTolerance)
+	if tolerance < minPaddingTolerance {
+		tolerance = minPaddingTolerance
+	}
+
+	n := int64(float64(target-baseSize) / r.fillerRatio)
+	for i := 0; i < paddingAttempts; i++ {
+		c.Files = append(base[:len(base):len(base)], &chart.File{Name: fillerFile, Data: r.filler(entropy, n)})
+		if buf, size, err = r.measure(r.opts.packager, c); err != nil {
+			return nil, 0, err
+		}
+
+		if grown := size - baseSize; grown > 0 && n > 0 {
+			r.fillerRatio = float64(grown) / float64(n)
+		}
+		diff := target - size
+		if diff >= -tolerance && diff <= tolerance {
+			break
+		}
+		if n += int64(float64(diff) / r.fillerRatio); n < 0 {
+			n = 0
+		}
+	}
+
+	return buf, size, nil
+}
+
+// measure packages c with p and returns the package and its size. When charts are streamed,
+// only the size is returned, as they are packaged again while they are sent.
+func (r *routine) measure(p packager, c *chart.Chart) (*bytes.Buffer, int64, error) {
+	if r.opts.streaming {
+		w := &countingWriter{Writer: ioutil.Discard}
+		err := p.Write(w, c)
+		return nil, w.n, err
+	}
+
+	buf := &bytes.Buffer{}
+	if err := p.Write(buf, c); err != nil {
+		return nil, 0, err
+	}
+	return buf, int64(buf.Len()), nil
+}
+
+// filler returns n bytes of random data, which is either compressible text or incompressible binary.
+func (r *routine) filler(entropy *random.Entropy, n int64) []byte {
+	if !r.opts.compressible {
+		b := make([]byte, n)
+		entropy.Rand.Read(b)
+		return b
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, n+64))
+	for int64(buf.Len()) < n {
+		fmt.Fprintf(buf, "%s-%d: %s\n",
+			fillerWords[entropy.Intn(len(fillerWords))], entropy.Intn(1000), fillerWords[entropy.Intn(len(fillerWords))])
+	}
+	return buf.Bytes()[:n]
+}
@@ -0,0 +1,44 @@
+package pusher
+
+import (
+	"testing"
+
+	"github.com/wahabmk/helm-pusher/pkg/random"
+)
+
+func TestPackagePadded(t *testing.T) {
+	for _, compressible := range []bool{false, true} {
+		r := newTestRoutine(t, scaffold(t), 1, WithPackageSize(random.Fixed(1), compressible))
+		entropy := random.New(1)
+		// Targets follow each other, so that the ratio of the filler learnt from one is corrected for the next.
+		for _, target := range []int64{8 << 10, 64 << 10, 1 << 20, 32 << 10} {
+			buf, size, err := r.packagePadded(entropy, r.chart, target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(buf.Len()) != size {
+				t.Errorf("package has %d bytes, but its size is %d", buf.Len(), size)
+			}
+
+			tolerance := int64(float64(target) * paddingTolerance)
+			if tolerance < minPaddingTolerance {
+				tolerance = minPaddingTolerance
+			}
+			if diff := size - target; diff < -tolerance || diff > tolerance {
+				t.Errorf("chart padded with compressible filler %v to %d bytes is %d bytes, want within %d", compressible, target, size, tolerance)
+			}
+		}
+	}
+
+	// Charts that are already larger than the target are not padded.
+	r := newTestRoutine(t, scaffold(t), 1, WithPackageSize(random.Fixed(1), false))
+	files := len(r.chart.Files)
+	buf, size, err := r.packagePadded(random.New(1), r.chart, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(buf.Len()) != size || len(r.chart.Files) != files {
+		t.Errorf("chart larger than its target has %d files and a package of %d bytes, want %d files and %d bytes",
+			len(r.chart.Files), buf.Len(), files, size)
+	}
+}
@@ -0,0 +1,208 @@
+package pusher
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// ttyRefresh is how often the live view is redrawn.
+	ttyRefresh = 500 * time.Millisecond
+	// plainRefresh is how often a plain progress line is printed when something has changed.
+	plainRefresh = 5 * time.Second
+	// rateWindow is the period over which the current push rate is calculated.
+	rateWindow = 5 * time.Second
+	barWidth   = 30
+)
+
+// progress reports the state of the routines while they are pushing. When the output is a
+// terminal it renders a live view that is redrawn in place, otherwise it prints a plain line
+// whenever something has changed.
+type progress struct {
+	out            io.Writer
+	tty            bool
+	verbose        bool
+	nCharts        int64
+	repeatFailures bool
+	routines       []*routine
+	startTime      time.Time
+
+	// lines is the number of lines drawn by the last render of the live view.
+	lines int
+	// last is the snapshot printed by the last plain line.
+	last snapshot
+	// window has the snapshots taken within the last rateWindow.
+	window []snapshot
+}
+
+// snapshot is the state of all routines at a point in time.
+type snapshot struct {
+	at        time.Time
+	completed int64
+	errors    int64
+	inFlight  int64
+	lastError routineError
+}
+
+func newProgress(out *os.File, verbose bool, nCharts int64, repeatFailures bool, routines []*routine) *progress {
+	return &progress{
+		out:            out,
+		tty:            isTerminal(out),
+		verbose:        verbose,
+		nCharts:        nCharts,
+		repeatFailures: repeatFailures,
+		routines:       routines,
+	}
+}
+
+// run reports progress until done is closed, after which it reports the final state and closes stopped.
+func (p *progress) run(startTime time.Time, done <-chan struct{}, stopped chan<- struct{}) {
+	defer close(stopped)
+
+	p.startTime = startTime
+	interval := plainRefresh
+	if p.tty {
+		interval = ttyRefresh
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			p.report(p.snapshot(), true)
+			return
+		case <-ticker.C:
+			p.report(p.snapshot(), false)
+		}
+	}
+}
+
+// snapshot collects the current state of the routines.
+func (p *progress) snapshot() snapshot {
+	s := snapshot{at: time.Now()}
+	for _, r := range p.routines {
+		s.completed += atomic.LoadInt64(&r.completed)
+		s.errors += atomic.LoadInt64(&r.errors)
+		s.inFlight += int64(atomic.LoadInt32(&r.inFlight))
+		if e, ok := r.lastError.Load().(routineError); ok && e.at.After(s.lastError.at) {
+			s.lastError = e
+		}
+	}
+
+	p.window = append(p.window, s)
+	for len(p.window) > 1 && s.at.Sub(p.window[0].at) > rateWindow {
+		p.window = p.window[1:]
+	}
+
+	return s
+}
+
+// total returns the number of push attempts that will be made, which grows with every
+// error when failures are repeated.
+func (p *progress) total(s snapshot) int64 {
+	if p.repeatFailures {
+		return p.nCharts + s.errors
+	}
+	return p.nCharts
+}
+
+// rate returns the number of push attempts completed per second over the last rateWindow.
+func (p *progress) rate() float64 {
+	first, last := p.window[0], p.window[len(p.window)-1]
+	if d := last.at.Sub(first.at).Seconds(); d > 0 {
+		return float64(last.completed-first.completed) / d
+	}
+	return 0
+}
+
+func (p *progress) report(s snapshot, final bool) {
+	if p.tty {
+		p.render(s)
+		return
+	}
+
+	if !final && s.completed == p.last.completed && s.errors == p.last.errors {
+		return
+	}
+	p.last = s
+
+	if p.verbose {
+		fmt.Fprintln(p.out, p.line(s))
+	} else if !final {
+		fmt.Fprintf(p.out, "... ")
+	}
+}
+
+// line returns a one line description of the snapshot for non-interactive output.
+func (p *progress) line(s snapshot) string {
+	return fmt.Sprintf("%d/%d chart push attempts\twith %d (%.2f perc) errors\tat %.1f/s\tETA %s\tin %v",
+		s.completed, p.total(s), s.errors, percent(s.errors, s.completed), p.rate(), p.eta(s), s.at.Sub(p.startTime).Round(time.Millisecond))
+}
+
+// render redraws the live view in place of the previous one.
+func (p *progress) render(s snapshot) {
+	total := p.total(s)
+	filled := 0
+	if total > 0 {
+		filled = int(float64(barWidth) * float64(s.completed) / float64(total))
+	}
+	if filled > barWidth {
+		filled = barWidth
+	}
+
+	lastError := "None"
+	if s.lastError.msg != "" {
+		lastError = fmt.Sprintf("%s (%v ago)", s.lastError.msg, s.at.Sub(s.lastError.at).Round(time.Second))
+	}
+
+	lines := []string{
+		fmt.Sprintf("[%s%s] %d/%d (%.2f%%)", strings.Repeat("#", filled), strings.Repeat("-", barWidth-filled), s.completed, total, percent(s.completed, total)),
+		fmt.Sprintf("Rate: %.1f/s\tETA: %s\tElapsed: %v", p.rate(), p.eta(s), s.at.Sub(p.startTime).Round(time.Second)),
+		fmt.Sprintf("In-flight: %d\tErrors: %d (%.2f%%)", s.inFlight, s.errors, percent(s.errors, s.completed)),
+		fmt.Sprintf("Last error: %s", lastError),
+	}
+
+	if p.lines > 0 {
+		// Move the cursor to the start of the previous view and clear everything below it.
+		fmt.Fprintf(p.out, "\033[%dA\033[J", p.lines)
+	}
+	for _, l := range lines {
+		fmt.Fprintf(p.out, "\033[K%s\n", l)
+	}
+	p.lines = len(lines)
+}
+
+// eta returns the estimated time remaining at the current rate.
+func (p *progress) eta(s snapshot) string {
+	remaining := p.total(s) - s.completed
+	if remaining <= 0 {
+		return "0s"
+	}
+	rate := p.rate()
+	if rate <= 0 {
+		return "unknown"
+	}
+	return (time.Duration(float64(remaining)/rate) * time.Second).String()
+}
+
+func percent(n, of int64) float64 {
+	if of == 0 {
+		return 0
+	}
+	return float64(n*100) / float64(of)
+}
+
+// isTerminal reports whether f is a character device such as an interactive terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
@@ -8,6 +8,8 @@ import (
 	"sync"
 	"time"
 
+	"github.com/wahabmk/helm-pusher/pkg/helm"
+	"github.com/wahabmk/helm-pusher/pkg/random"
 	"helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chart/loader"
 )
@@ -20,15 +22,13 @@ type Pusher struct {
 	nCharts        int64
 	nVersions      int64
 	nRoutines      int64
-	url            string
-	username       string
-	password       string
 	repeatFailures bool
 	verbose        bool
 	helmExec       string
+	opts           options
 }
 
-func New(nCharts, nVersions, nRoutines int64, url, username, password string, repeatFailures, verbose bool) (*Pusher, error) {
+func New(nCharts, nVersions, nRoutines int64, url, username, password string, repeatFailures, verbose bool, opts ...Option) (*Pusher, error) {
 	if nRoutines <= 0 {
 		return nil, fmt.Errorf("nRoutines cannot be <= 0")
 	}
@@ -48,34 +48,205 @@ func New(nCharts, nVersions, nRoutines int64, url, username, password string, re
 		return nil, err
 	}
 
-	return &Pusher{
+	p := &Pusher{
 		nCharts:        nCharts,
 		nVersions:      nVersions,
 		nRoutines:      nRoutines,
-		url:            url,
-		username:       username,
-		password:       password,
 		repeatFailures: repeatFailures,
 		verbose:        verbose,
 		helmExec:       helmExec,
-	}, nil
+		opts:           defaultOptions(),
+	}
+	for _, opt := range opts {
+		opt(&p.opts)
+	}
+	if p.opts.target == nil {
+		p.opts.target = NewChartMuseum(url, username, password)
+	}
+	if err := p.opts.validate(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
 }
 
 func (p *Pusher) Push() error {
+	routines, cleanup, err := p.newRoutines()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	fmt.Printf("Pushing %d charts:\n", p.nCharts)
+	fmt.Printf("* To %s\n", p.opts.target)
+	for _, o := range p.describe() {
+		fmt.Printf("* %s\n", o)
+	}
+	p.printRun()
+
+	elapsed := p.run(routines, true, p.repeatFailures, func(r *routine) {
+		r.push(p.nVersions)
+	})
+	p.printResults("pushed", routines, elapsed)
+
+	return nil
+}
+
+// Generate packages charts in the same way as Push, but writes them to dir along with a manifest
+// instead of pushing them, so that they can be pushed later with PushDir.
+func (p *Pusher) Generate(dir string) error {
+	if p.opts.hostile > 0 {
+		return errCorpusHostile
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("unable to create corpus directory: %w", err)
+	}
+
+	routines, cleanup, err := p.newRoutines()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	c := &corpus{dir: dir}
+	for _, r := range routines {
+		r.corpus = c
+	}
+
+	options := p.describe()
+	fmt.Printf("Generating %d charts:\n", p.nCharts)
+	fmt.Printf("* To %s\n", dir)
+	for _, o := range options {
+		fmt.Printf("* %s\n", o)
+	}
+	p.printRun()
+
+	elapsed := p.run(routines, false, p.repeatFailures, func(r *routine) {
+		r.push(p.nVersions)
+	})
+	if err := c.writeManifest(options); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	p.printResults("generated", routines, elapsed)
+
+	return nil
+}
+
+// PushDir pushes the charts that Generate wrote to dir, in the order they were generated. If dir
+// has no manifest, the chart archives in it are loaded with the Helm loader instead, and those
+// that load are pushed in the order set by WithOriginalOrder. The number of charts and versions
+// come from the corpus instead of the Pusher.
+func (p *Pusher) PushDir(dir string) error {
+	m, err := readManifest(dir)
+	var invalid []invalidArchive
+	if os.IsNotExist(err) {
+		m = &manifest{}
+		if m.Charts, invalid, err = scanArchives(dir, p.nRoutines); err == nil {
+			sortArchives(m.Charts, p.opts.originalOrder, p.opts.replaySpeedup)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read corpus %q: %w", dir, err)
+	}
+	if len(m.Charts) == 0 {
+		printInvalid(os.Stdout, invalid)
+		return fmt.Errorf("corpus %q has no charts", dir)
+	}
+	p.nCharts = int64(len(m.Charts))
+
+	// Charts are only pushed in the original order across charts by a single routine, unless pushes
+	// are paced, in which case each routine waits for the time of each of its charts.
+	ordered := m.Generated.IsZero() && p.opts.originalOrder && p.opts.replaySpeedup <= 0
+	if ordered {
+		p.nRoutines = 1
+	}
+	split := splitCorpus(m.Charts, p.nRoutines)
+	routines := make([]*routine, p.nRoutines)
+	for i := int64(0); i < p.nRoutines; i++ {
+		routines[i] = &routine{
+			id:             i,
+			nCharts:        int64(len(split[i])),
+			repeatFailures: p.repeatFailures,
+			errorKinds:     map[string]interface{}{},
+			opts:           &p.opts,
+		}
+	}
+
+	fmt.Printf("Pushing %d charts:\n", p.nCharts)
+	fmt.Printf("* To %s\n", p.opts.target)
+	if m.Generated.IsZero() {
+		fmt.Printf("* From chart archives in %s\n", dir)
+		printInvalid(os.Stdout, invalid)
+		if ordered {
+			fmt.Printf("* With original upload order, one chart at a time\n")
+		} else if p.opts.originalOrder {
+			fmt.Printf("* With original upload order (replay speedup = %v)\n", p.opts.replaySpeedup)
+		}
+	} else {
+		fmt.Printf("* From %s (generated at %s)\n", dir, m.Generated.Format(time.RFC3339))
+	}
+	for _, o := range m.Options {
+		fmt.Printf("* %s\n", o)
+	}
+	p.printRun()
+	if p.repeatFailures {
+		fmt.Printf("* With retries per chart = %d\n", p.opts.corpusRetries)
+	}
+
+	elapsed := p.run(routines, true, p.repeatFailures, func(r *routine) {
+		r.pushCorpus(dir, split[r.id])
+	})
+	p.printResults("pushed", routines, elapsed)
+
+	return nil
+}
+
+// newRoutines creates the template chart, and the routines that generate charts from it.
+// The returned function removes the template chart.
+func (p *Pusher) newRoutines() ([]*routine, func(), error) {
 	// Create template chart
 	if err := p.helm("create", templateChart); err != nil {
-		return fmt.Errorf("unable to create temporary Helm chart: %s", err)
+		return nil, nil, fmt.Errorf("unable to create temporary Helm chart: %s", err)
 	}
 
-	defer func() {
+	cleanup := func() {
 		if err := os.RemoveAll(templateChart); err != nil {
 			println(fmt.Sprintf("error removing template chart: %s", err))
 		}
-	}()
+	}
 
 	chartTempl, err := loader.LoadDir(templateChart)
 	if err != nil {
-		return fmt.Errorf("failed to load template chart %q: %w", templateChart, err)
+		cleanup()
+		return nil, nil, fmt.Errorf("failed to load template chart %q: %w", templateChart, err)
+	}
+
+	routines, err := p.routinesFor(chartTempl)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return routines, cleanup, nil
+}
+
+// routinesFor adds the configured structure to the template chart c, and creates the routines
+// that generate charts from it.
+func (p *Pusher) routinesFor(c *chart.Chart) ([]*routine, error) {
+	if p.opts.structure != nil {
+		if err := buildStructure(random.New(1), p.opts.structure, c, 0); err != nil {
+			return nil, fmt.Errorf("failed to build chart structure: %w", err)
+		}
+	}
+
+	// The packaging cache is built once, and shared by the routines.
+	var (
+		template, legacyTemplate *helm.Template
+		err                      error
+	)
+	if p.opts.cache {
+		if template, legacyTemplate, err = p.templates(c); err != nil {
+			return nil, fmt.Errorf("failed to build packaging cache: %w", err)
+		}
 	}
 
 	// Create objects for the number fo go-routines required.
@@ -85,9 +256,12 @@ func (p *Pusher) Push() error {
 		routines[i] = &routine{
 			id:             i,
 			nCharts:        int64(each),
-			chart:          func(c chart.Chart) *chart.Chart { return &c }(*chartTempl),
+			chart:          copyChartTree(c),
 			repeatFailures: p.repeatFailures,
 			errorKinds:     map[string]interface{}{},
+			opts:           &p.opts,
+			template:       template,
+			legacyTemplate: legacyTemplate,
 		}
 	}
 
@@ -95,67 +269,141 @@ func (p *Pusher) Push() error {
 		routines[len(routines)-1].nCharts -= diff
 	}
 
-	var startTime time.Time
-	// Go-routine to log progress every few seconds.
-	go func() {
-		for {
-			time.Sleep(5 * time.Second)
-			if p.verbose {
-				var done int64 = 0
-				var errors int64 = 0
-				for i := int64(0); i < p.nRoutines; i++ {
-					// done and errors may not be accurate because the write is not synchronized,
-					// but this is just for logging so it is okay.
-					done += routines[i].nCharts
-					errors += routines[i].errors
-				}
-				fmt.Printf("%d chart push attempts\twith %d (%.2f perc) errors\tin %v\n", p.nCharts-done, errors, float64(errors*100)/float64(p.nCharts-done), time.Now().Sub(startTime).Round(1*time.Millisecond))
-			} else {
-				fmt.Printf("... ")
-			}
-		}
-	}()
+	return routines, nil
+}
 
-	fmt.Printf("Pushing %d charts:\n", p.nCharts)
-	fmt.Printf("* To %s\n", p.url)
-	fmt.Printf("* With each chart having random number of versions between 1 to %d\n", p.nVersions)
+// templates returns the packaging cache of c, and of its apiVersion v1 copy if legacy charts are
+// generated.
+func (p *Pusher) templates(c *chart.Chart) (*helm.Template, *helm.Template, error) {
+	template, err := p.opts.packager.Template(c)
+	if err != nil || p.opts.legacy <= 0 {
+		return template, nil, err
+	}
+
+	legacy, err := legacyChart(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	legacyTemplate, err := p.opts.packager.Template(legacy)
+	if err != nil {
+		return nil, nil, err
+	}
+	return template, legacyTemplate, nil
+}
+
+// describe returns a line for each option with which charts are generated.
+func (p *Pusher) describe() []string {
+	var lines []string
+	add := func(format string, a ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, a...))
+	}
+
+	add("With chart names = %s", p.opts.namer)
+	if p.opts.versionsPerChart != nil {
+		add("With each chart having number of versions = %s", p.opts.versionsPerChart)
+	} else {
+		add("With each chart having random number of versions between 1 to %d", p.nVersions)
+	}
+	add("With versions = %s", p.opts.versioner)
+	if p.opts.packageSize != nil {
+		add("With package sizes = %s (compressible filler = %v)", p.opts.packageSize, p.opts.compressible)
+	}
+	if p.opts.metadata != nil {
+		add("With Chart.yaml field probabilities = %s", p.opts.metadata)
+	}
+	if p.opts.legacy > 0 {
+		add("With apiVersion v1 charts = %.2f perc", p.opts.legacy*100)
+	}
+	if p.opts.hostile > 0 {
+		add("With hostile charts = %.2f perc (%d cases)", p.opts.hostile*100, len(p.opts.hostileCases))
+	}
+	if p.opts.structure != nil {
+		add("With chart structure = %s", p.opts.structure)
+	}
+	if p.opts.mutation != nil {
+		add("With changes between versions = %s", p.opts.mutation)
+	}
+	if p.opts.packager.Mode != helm.Default {
+		add("With packaging = %s", p.opts.packager.Mode)
+	}
+	if p.opts.cache {
+		add("With packaging cache")
+	}
+	if p.opts.streaming {
+		add("With streaming uploads (precomputed length = %v)", p.opts.streamSized)
+	}
+	return lines
+}
+
+func (p *Pusher) printRun() {
 	fmt.Printf("* With go-routines = %d\n", p.nRoutines)
 	fmt.Printf("* With repeat failues = %v\n", p.repeatFailures)
 	fmt.Printf("* With verbose logging = %v\n", p.verbose)
+}
 
-	delay := 10 * time.Second
-	fmt.Printf("\nStarting in %v ...\n\n", delay)
-	time.Sleep(delay)
+// run runs f for every routine, after a delay if delay is set, and returns how long they took.
+func (p *Pusher) run(routines []*routine, delay, repeatFailures bool, f func(r *routine)) time.Duration {
+	if delay {
+		d := 10 * time.Second
+		fmt.Printf("\nStarting in %v ...\n\n", d)
+		time.Sleep(d)
+	} else {
+		fmt.Printf("\n")
+	}
+
+	startTime := time.Now()
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go newProgress(os.Stdout, p.verbose, p.nCharts, repeatFailures, routines).run(startTime, done, stopped)
 
-	startTime = time.Now()
 	var wg sync.WaitGroup
-	for i := int64(0); i < p.nRoutines; i++ {
+	for i := range routines {
 		wg.Add(1)
-		go func(idx int64) {
-			routines[idx].push(p.nVersions, p.url, p.username, p.password)
+		go func(r *routine) {
+			f(r)
 			wg.Done()
-		}(i)
+		}(routines[i])
 	}
 	wg.Wait()
 	endTime := time.Now()
+	close(done)
+	<-stopped
 
-	// Output results.
+	return endTime.Sub(startTime)
+}
+
+// printResults writes the results of the routines, which took elapsed to have their charts verb.
+func (p *Pusher) printResults(verb string, routines []*routine, elapsed time.Duration) {
 	var errors int64 = 0
-	for i := int64(0); i < p.nRoutines; i++ {
-		errors += routines[i].errors
+	var total stats
+	for _, r := range routines {
+		errors += r.errors
+		total.merge(&r.stats)
+	}
+
+	// Hostile charts are expected to be rejected, so they are reported apart from the other charts.
+	var hostile int64
+	for _, h := range total.hostile {
+		hostile += h.pushed
 	}
 
 	// TODO: Find better way of determining number of charts successfully pushed.
 	// Currently if `repeatFailures=true`, then this number is inaccurate.
 	fmt.Printf("\n\nResults:\n")
-	fmt.Printf("* Charts successfully pushed: %d\n", p.nCharts-errors)
-	fmt.Printf("* Time elapsed: %v\n", endTime.Sub(startTime).Round(1*time.Millisecond))
+	fmt.Printf("* Charts successfully %s: %d\n", verb, p.nCharts-errors-hostile)
+	if hostile > 0 {
+		fmt.Printf("* Hostile charts %s: %d\n", verb, hostile)
+	}
+	fmt.Printf("* Time elapsed: %v\n", elapsed.Round(1*time.Millisecond))
+	total.print(os.Stdout, elapsed)
+	if rep, ok := p.opts.target.(Reporter); ok {
+		rep.Report(os.Stdout)
+	}
 	fmt.Printf("* Errors encountered: %d\n", errors)
 	fmt.Printf("* Kinds of errors encountered: ")
 
 	errKinds := map[string]interface{}{}
-	for i := int64(0); i < p.nRoutines; i++ {
-		for e := range routines[i].errorKinds {
+	for _, r := range routines {
+		for e := range r.errorKinds {
 			errKinds[e] = nil
 		}
 	}
@@ -170,8 +418,18 @@ func (p *Pusher) Push() error {
 		fmt.Printf("\t%d. %s\n", i, e)
 		i++
 	}
+}
 
-	return nil
+// copyChart returns a copy of c that can be modified without affecting c.
+func copyChart(c *chart.Chart) *chart.Chart {
+	cp := *c
+	md := *c.Metadata
+	cp.Metadata = &md
+	cp.Templates = c.Templates[:len(c.Templates):len(c.Templates)]
+	cp.Files = c.Files[:len(c.Files):len(c.Files)]
+	cp.Raw = c.Raw[:len(c.Raw):len(c.Raw)]
+	md.Dependencies = md.Dependencies[:len(md.Dependencies):len(md.Dependencies)]
+	return &cp
 }
 
 func (p *Pusher) helm(arg ...string) error {
@@ -5,10 +5,9 @@ import (
 	"crypto/tls"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"math/rand"
 	"net/http"
-	"net/url"
+	"sync/atomic"
+	"time"
 
 	"github.com/Masterminds/semver/v3"
 	"github.com/wahabmk/helm-pusher/pkg/helm"
@@ -34,6 +33,32 @@ type routine struct {
 	chart          *chart.Chart
 	repeatFailures bool
 	errorKinds     map[string]interface{}
+	opts           *options
+	stats          stats
+	// fillerRatio is the compression ratio of the filler used to pad charts.
+	fillerRatio float64
+	// baseMetadata is the metadata of the template chart that generated metadata starts from.
+	baseMetadata *chart.Metadata
+	// template and legacyTemplate package charts when the packaging cache is used. They are shared
+	// by all routines.
+	template       *helm.Template
+	legacyTemplate *helm.Template
+	// corpus collects the generated charts instead of pushing them when set.
+	corpus *corpus
+	// history is the content of the latest version of the current chart, when versions are mutated.
+	history *chart.Chart
+
+	// completed, inFlight and lastError are also read by the progress view while the routine is
+	// running, as is errors. A push attempt is completed once its chart has been pushed, or has failed.
+	completed int64
+	inFlight  int32
+	lastError atomic.Value
+}
+
+// routineError is the most recent error encountered by a routine.
+type routineError struct {
+	msg string
+	at  time.Time
 }
 
 // Push creates and pushes `N` charts with each chart having random number of versions upto `versions`.
@@ -41,10 +66,11 @@ type routine struct {
 // TODO: Sometimes pushing returns with status 422. Status 422 in MSR is returned when the chart already exists.
 // Maybe there is some issue with randomness that creates charts with equal name?
 // This bug has been observed fairly consistently with the following parameters:
-// 	nCharts        = 10
+//
+//	nCharts        = 10
 //	nVersions      = 2
 //	nRoutines      = 2
-func (r *routine) push(versions int64, url, username, password string) {
+func (r *routine) push(versions int64) {
 	entropy := random.New(r.id + 1)
 
 	for r.nCharts > 0 {
@@ -53,80 +79,109 @@ func (r *routine) push(versions int64, url, username, password string) {
 			continue
 		}
 
-		_versions := r.versionsToCreate(versions)
+		_versions := r.versionsToCreate(entropy, versions)
 		r.nCharts -= _versions
 
-		for i := _versions; i > 0; i-- {
-			version, err := r.generateVersion(entropy, _versions)
-			if err != nil {
-				continue
-			}
+		legacy := r.opts.legacy > 0 && entropy.Float64() < r.opts.legacy
+		if legacy {
+			r.stats.legacyCharts++
+		}
 
-			reader, err := r.generateChart(name, version)
-			if err != nil {
-				continue
+		var (
+			previous *semver.Version
+			pushed   int64
+		)
+		r.history = nil
+		for i := _versions; i > 0; i-- {
+			version, ok := r.pushVersion(entropy, name, previous, legacy, i < _versions)
+			atomic.AddInt64(&r.completed, 1)
+			if version != nil {
+				previous = version
 			}
-
-			if err = r.pushChart(reader, username, password, url, false); err != nil {
-				continue
+			if ok {
+				pushed++
 			}
 		}
+		r.stats.versionsPerChart.add(pushed)
 	}
 }
 
-func (r *routine) generateName(entropy *random.Entropy) (string, error) {
-	u, err := entropy.String()
+// pushVersion generates the version of the chart with the given name that follows previous, and
+// pushes it, after mutating the content of the previous version if mutate is set. It returns the
+// version, or nil if none could be generated, and whether the chart was pushed.
+func (r *routine) pushVersion(entropy *random.Entropy, name string, previous *semver.Version, legacy, mutate bool) (*semver.Version, bool) {
+	version, err := r.generateVersion(entropy, previous)
 	if err != nil {
-		r.errors++
-		r.errorKinds[err.Error()] = nil
-		if r.repeatFailures {
-			r.nCharts++
+		return nil, false
+	}
+
+	if r.opts.mutation != nil && mutate {
+		if err := r.mutate(entropy); err != nil {
+			r.recordError(err)
+			return version, false
 		}
-		return "", fmt.Errorf("error generating name: %w", err)
 	}
 
-	return u, nil
-}
+	if r.opts.hostile > 0 && entropy.Float64() < r.opts.hostile {
+		r.pushHostile(entropy, name, version.String())
+		return version, false
+	}
 
-func (r *routine) generateVersion(entropy *random.Entropy, versions int64) (string, error) {
-	var (
-		err        error
-		prerelease string
-		version    *semver.Version
-	)
+	reader, size, err := r.generateChart(entropy, name, version.String(), legacy)
+	if err != nil {
+		return version, false
+	}
 
-	defer func() {
-		if err != nil {
-			r.errors++
-			r.errorKinds[err.Error()] = nil
-			if r.repeatFailures {
-				r.nCharts++
-			}
-		}
-	}()
+	if r.corpus != nil {
+		err = r.saveChart(reader, name, version.String(), legacy)
+	} else {
+		err = r.pushChart(reader, size, name, version.String())
+	}
+	return version, err == nil
+}
 
-	major := rand.Int63()
-	minor := rand.Int63()
-	patch := rand.Int63()
-	prerelease, err = entropy.String()
+// recordError accounts for an error that caused a chart push to be abandoned.
+func (r *routine) recordError(err error) {
+	atomic.AddInt64(&r.errors, 1)
+	r.errorKinds[errorKind(err)] = nil
+	r.lastError.Store(routineError{msg: err.Error(), at: time.Now()})
+	if r.repeatFailures {
+		r.nCharts++
+	}
+}
+
+func (r *routine) generateName(entropy *random.Entropy) (string, error) {
+	name, err := r.opts.namer.Name(entropy)
 	if err != nil {
-		err = fmt.Errorf("error generating prerelease: %w", err)
-		return "", err
+		r.recordError(err)
+		return "", fmt.Errorf("error generating name: %w", err)
 	}
 
-	ver := fmt.Sprintf("%d.%d.%d-%s", major, minor, patch, prerelease)
-	version, err = semver.NewVersion(ver)
+	return name, nil
+}
+
+func (r *routine) generateVersion(entropy *random.Entropy, previous *semver.Version) (*semver.Version, error) {
+	version, err := r.opts.versioner.Next(entropy, previous)
 	if err != nil {
-		return "", err
+		r.recordError(err)
+		return nil, err
 	}
 
-	return version.String(), nil
+	return version, nil
 }
 
-func (r *routine) versionsToCreate(versions int64) int64 {
+func (r *routine) versionsToCreate(entropy *random.Entropy, versions int64) int64 {
 	var _versions int64
 
-	if versions <= 0 {
+	if r.opts.versionsPerChart != nil {
+		_versions = r.opts.versionsPerChart.Sample(entropy.Rand)
+		if _versions < 1 {
+			_versions = 1
+		}
+		if _versions > r.nCharts {
+			_versions = r.nCharts
+		}
+	} else if versions <= 0 {
 		_versions = 0
 	} else if versions == 1 {
 		_versions = 1
@@ -139,77 +194,70 @@ func (r *routine) versionsToCreate(versions int64) int64 {
 	return _versions
 }
 
-func (r *routine) generateChart(name, version string) (io.Reader, error) {
-	r.chart.Metadata.Name = name
-	r.chart.Metadata.Version = version
-
-	buf, err := helm.PackageChart(r.chart)
-	if err != nil {
-		r.errors++
-		r.errorKinds[err.Error()] = nil
-		if r.repeatFailures {
-			r.nCharts++
-		}
-
-		return nil, fmt.Errorf("failed to package chart: %w", err)
-	}
-
-	return buf, nil
-}
-
-func (r *routine) pushChart(reader io.Reader, username, password, u string, force bool) error {
-	_u, err := url.Parse(u)
-	if err != nil {
-		return err
+// generateChart packages the template chart with the given name and version, as an
+// apiVersion v1 chart if legacy is set. It returns the package and its size, which is
+// -1 if the chart is streamed with chunked encoding.
+func (r *routine) generateChart(entropy *random.Entropy, name, version string, legacy bool) (io.Reader, int64, error) {
+	if r.opts.metadata != nil {
+		r.generateMetadata(entropy, name, version)
+	} else {
+		r.chart.Metadata.Name = name
+		r.chart.Metadata.Version = version
 	}
 
-	return r.pushContent(username, password, reader, "application/octet-stream", _u, force)
-}
-
-func (r *routine) pushContent(username, password string, reader io.Reader, contentType string, u *url.URL, force bool) error {
 	var (
+		buf  *bytes.Buffer
+		size int64 = -1
 		err  error
-		b    []byte
-		req  *http.Request
-		resp *http.Response
 	)
-
-	defer func() {
-		if err != nil {
-			r.errors++
-			r.errorKinds[err.Error()] = nil
-			if r.repeatFailures {
-				r.nCharts++
-			}
+	c := r.chart
+	if r.history != nil {
+		md := *r.chart.Metadata
+		md.Dependencies = r.history.Metadata.Dependencies
+		r.history.Metadata = &md
+		c = r.history
+	}
+	if legacy {
+		c, err = legacyChart(c)
+	}
+	p := r.packagerFor(legacy)
+	if err == nil {
+		if r.opts.packageSize != nil {
+			buf, size, err = r.packagePadded(entropy, c, r.opts.packageSize.Sample(entropy.Rand))
+		} else if !r.opts.streaming || r.opts.streamSized {
+			buf, size, err = r.measure(p, c)
 		}
-	}()
-
-	b, err = ioutil.ReadAll(reader)
-	if err != nil {
-		return err
 	}
-
-	req, err = http.NewRequest(http.MethodPost, u.String(), bytes.NewBuffer(b))
 	if err != nil {
-		return err
+		r.recordError(err)
+		return nil, 0, fmt.Errorf("failed to package chart: %w", err)
 	}
-	req.SetBasicAuth(username, password)
-	req.Header.Set("Content-Type", contentType)
 
-	if force {
-		q := req.URL.Query()
-		q.Add("force", "")
-		req.URL.RawQuery = q.Encode()
+	if r.opts.streaming {
+		if !r.opts.streamSized {
+			size = -1
+		}
+		return streamChart(p, c, size), size, nil
 	}
+	r.stats.packageSizes.add(size)
 
-	resp, err = httpClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
+	return buf, size, nil
+}
 
-	if resp.StatusCode != http.StatusCreated {
-		err = fmt.Errorf("returned with status %d", resp.StatusCode)
+// pushChart pushes the package read from reader, which is size bytes long or -1 if it is streamed
+// with chunked encoding, to the target.
+func (r *routine) pushChart(reader io.Reader, size int64, name, version string) error {
+	err := r.opts.target.Push(r, name, version, reader, size)
+	if s, ok := reader.(*chartStream); ok {
+		// Packaging has to stop before the chart changes, even if the push failed before
+		// reading all of it.
+		n, serr := s.wait()
+		if serr == nil {
+			r.stats.packageSizes.add(n)
+		}
+	}
+	if err != nil {
+		r.recordError(err)
 		return err
 	}
 
@@ -0,0 +1,133 @@
+package pusher
+
+import (
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/wahabmk/helm-pusher/pkg/helm"
+	"github.com/wahabmk/helm-pusher/pkg/random"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+// scaffold returns the chart that `helm create` generates, which is the template chart of runs.
+func scaffold(t testing.TB) *chart.Chart {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "pusher-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path, err := chartutil.Create("scaffold", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := loader.LoadDir(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// newTestRoutine returns a routine that generates nCharts charts from c with the given options.
+func newTestRoutine(t testing.TB, c *chart.Chart, nCharts int64, opts ...Option) *routine {
+	t.Helper()
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := o.validate(); err != nil {
+		t.Fatal(err)
+	}
+	return &routine{
+		nCharts:    nCharts,
+		chart:      c,
+		errorKinds: map[string]interface{}{},
+		opts:       &o,
+	}
+}
+
+// discardTarget reads and discards every chart pushed to it.
+type discardTarget struct{}
+
+func (discardTarget) Push(_ Doer, _, _ string, body io.Reader, _ int64) error {
+	_, err := io.Copy(ioutil.Discard, body)
+	return err
+}
+
+func (discardTarget) String() string {
+	return "discard"
+}
+
+// benchmarkPush generates and pushes a chart of about 1 MiB in each iteration, so that the
+// memory allocated per operation is that of a push in flight.
+func benchmarkPush(b *testing.B, opts ...Option) {
+	c := scaffold(b)
+	blob := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(blob)
+	c.Files = append(c.Files, &chart.File{Name: "files/blob", Data: blob})
+
+	r := newTestRoutine(b, c, 1, append(opts, WithTarget(discardTarget{}))...)
+	entropy := random.New(1)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		reader, size, err := r.generateChart(entropy, "bench", "0.1.0", false)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := r.pushChart(reader, size, "bench", "0.1.0"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPushBuffered(b *testing.B) {
+	benchmarkPush(b)
+}
+
+func BenchmarkPushStreamedChunked(b *testing.B) {
+	benchmarkPush(b, WithStreaming(false))
+}
+
+func BenchmarkPushStreamedSized(b *testing.B) {
+	benchmarkPush(b, WithStreaming(true), WithPackaging(helm.Reproducible))
+}
+
+func TestVersionsToCreate(t *testing.T) {
+	tests := []struct {
+		dist    random.Distribution
+		nCharts int64
+		want    int64
+	}{
+		{random.Fixed(3), 10, 3},
+		{random.Fixed(0), 10, 1},
+		{random.Fixed(50), 10, 10},
+		{nil, 10, 1},
+	}
+	for _, tt := range tests {
+		var opts []Option
+		if tt.dist != nil {
+			opts = append(opts, WithVersionsPerChart(tt.dist))
+		}
+		r := newTestRoutine(t, nil, tt.nCharts, opts...)
+		// Without a distribution, the number of versions given to push is used.
+		if got := r.versionsToCreate(random.New(1), 1); got != tt.want {
+			t.Errorf("versions to create with %v of %d charts are %d, want %d", tt.dist, tt.nCharts, got, tt.want)
+		}
+	}
+
+	// Sampled numbers of versions are between 1 and the charts left.
+	r := newTestRoutine(t, nil, 20, WithVersionsPerChart(&random.Uniform{Min: 0, Max: 30}))
+	entropy := random.New(1)
+	for i := 0; i < 1000; i++ {
+		if got := r.versionsToCreate(entropy, 1); got < 1 || got > 20 {
+			t.Fatalf("versions to create of 20 charts are %d", got)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package pusher
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// stats has the measurements that each go-routine collects while pushing.
+type stats struct {
+	requests     int64
+	bytesUp      int64
+	bytesDown    int64
+	packageSizes histogram
+	upload       histogram
+	download     histogram
+	timing       traceStats
+	// versionsPerChart has the number of versions successfully pushed for each chart.
+	versionsPerChart histogram
+	legacyCharts     int64
+	hostile          map[string]*hostileResult
+	mutations        mutationStats
+}
+
+// merge adds the measurements of s2 to s.
+func (s *stats) merge(s2 *stats) {
+	s.requests += s2.requests
+	s.bytesUp += s2.bytesUp
+	s.bytesDown += s2.bytesDown
+	s.packageSizes.merge(s2.packageSizes)
+	s.upload.merge(s2.upload)
+	s.download.merge(s2.download)
+	s.timing.merge(&s2.timing)
+	s.versionsPerChart.merge(s2.versionsPerChart)
+	s.legacyCharts += s2.legacyCharts
+	s.mutations.merge(&s2.mutations)
+	for name, h := range s2.hostile {
+		if s.hostile == nil {
+			s.hostile = map[string]*hostileResult{}
+		}
+		if _, ok := s.hostile[name]; !ok {
+			s.hostile[name] = &hostileResult{}
+		}
+		s.hostile[name].merge(h)
+	}
+}
+
+// print writes the measurements taken over `elapsed` to w.
+func (s *stats) print(w io.Writer, elapsed time.Duration) {
+	fmt.Fprintf(w, "* Requests sent: %d (%.2f/s)\n", s.requests, float64(s.requests)/elapsed.Seconds())
+	fmt.Fprintf(w, "* Bytes uploaded: %s (%s/s)\n", formatBytes(s.bytesUp), formatBytes(int64(float64(s.bytesUp)/elapsed.Seconds())))
+	fmt.Fprintf(w, "* Bytes downloaded: %s (%s/s)\n", formatBytes(s.bytesDown), formatBytes(int64(float64(s.bytesDown)/elapsed.Seconds())))
+	fmt.Fprintf(w, "* Upload bytes per request: %s\n", s.upload.summary(formatBytes))
+	fmt.Fprintf(w, "* Download bytes per request: %s\n", s.download.summary(formatBytes))
+	fmt.Fprintf(w, "* Package sizes: %s\n", s.packageSizes.summary(formatBytes))
+	s.timing.print(w)
+	if s.legacyCharts > 0 {
+		fmt.Fprintf(w, "* Charts generated with apiVersion v1: %d of %d\n", s.legacyCharts, len(s.versionsPerChart))
+	}
+	fmt.Fprintf(w, "* Versions pushed per chart: %s\n", s.versionsPerChart.summary(formatCount))
+	for _, b := range s.versionsPerChart.shape(versionBuckets) {
+		fmt.Fprintf(w, "\t%s versions: %d charts (%.2f perc)\n", b.label, b.count, percent(b.count, int64(len(s.versionsPerChart))))
+	}
+	s.mutations.print(w)
+	printHostile(w, s.hostile)
+}
+
+var (
+	// versionBuckets are the ranges in which the number of versions per chart are reported.
+	versionBuckets = []int64{0, 1, 5, 10, 50, 100, 500, 1000, 5000}
+)
+
+// histogram keeps every sample it is given so that exact percentiles can be reported.
+type histogram []int64
+
+func (h *histogram) add(v int64) {
+	*h = append(*h, v)
+}
+
+func (h *histogram) merge(h2 histogram) {
+	*h = append(*h, h2...)
+}
+
+// percentile returns the sample below which p percent of the samples fall.
+// NOTE: The histogram must be sorted.
+func (h histogram) percentile(p float64) int64 {
+	if len(h) == 0 {
+		return 0
+	}
+	idx := int(math.Ceil(p/100*float64(len(h)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return h[idx]
+}
+
+func (h histogram) mean() float64 {
+	if len(h) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range h {
+		sum += float64(v)
+	}
+	return sum / float64(len(h))
+}
+
+// summary returns a one line description of the histogram, using format to print each value.
+func (h histogram) summary(format func(int64) string) string {
+	if len(h) == 0 {
+		return "n/a"
+	}
+	sort.Slice(h, func(i, j int) bool { return h[i] < h[j] })
+
+	return fmt.Sprintf("min %s, mean %s, p50 %s, p90 %s, p99 %s, max %s (n=%d)",
+		format(h[0]), format(int64(h.mean())), format(h.percentile(50)), format(h.percentile(90)), format(h.percentile(99)), format(h[len(h)-1]), len(h))
+}
+
+// shapeBucket is the number of samples within a range of a histogram.
+type shapeBucket struct {
+	label string
+	count int64
+}
+
+// shape returns how many samples fall in each of the ranges that end at bounds, omitting empty ranges.
+// Samples larger than the last bound are counted in a final, open ended range.
+func (h histogram) shape(bounds []int64) []shapeBucket {
+	counts := make([]int64, len(bounds)+1)
+	for _, v := range h {
+		counts[sort.Search(len(bounds), func(i int) bool { return v <= bounds[i] })]++
+	}
+
+	var buckets []shapeBucket
+	for i, c := range counts {
+		if c == 0 {
+			continue
+		}
+
+		var label string
+		switch {
+		case i == len(bounds):
+			label = fmt.Sprintf("%d+", bounds[i-1]+1)
+		case i == 0 || bounds[i-1]+1 == bounds[i]:
+			label = fmt.Sprintf("%d", bounds[i])
+		default:
+			label = fmt.Sprintf("%d-%d", bounds[i-1]+1, bounds[i])
+		}
+		buckets = append(buckets, shapeBucket{label: label, count: c})
+	}
+	return buckets
+}
+
+func formatCount(n int64) string {
+	return fmt.Sprintf("%d", n)
+}
+
+func formatBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.2f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.Reader.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.Writer.Write(p)
+	c.n += int64(n)
+	return n, err
+}
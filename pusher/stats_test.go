@@ -0,0 +1,21 @@
+package pusher
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatsPrintLegacyCharts(t *testing.T) {
+	for _, legacy := range []int64{0, 2} {
+		s := stats{legacyCharts: legacy, versionsPerChart: histogram{1, 3, 2}}
+		var buf bytes.Buffer
+		s.print(&buf, time.Second)
+
+		printed := strings.Contains(buf.String(), "* Charts generated with apiVersion v1: 2 of 3\n")
+		if printed != (legacy > 0) {
+			t.Errorf("with %d legacy charts, the legacy line was printed = %v:\n%s", legacy, printed, buf.String())
+		}
+	}
+}
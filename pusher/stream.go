@@ -0,0 +1,58 @@
+package pusher
+
+import (
+	"errors"
+	"io"
+
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+var (
+	errStreamSize = errors.New("streaming with a precomputed length requires reproducible packaging")
+)
+
+// WithStreaming packages charts straight into the request body as it is sent, instead of into a
+// buffer first, so that memory per in-flight push does not grow with the size of charts. Charts
+// are sent with chunked encoding, unless sized is set, in which case each chart is packaged twice:
+// once to compute its length, which requires helm.Reproducible packaging, and once to send it.
+func WithStreaming(sized bool) Option {
+	return func(o *options) {
+		o.streaming = true
+		o.streamSized = sized
+	}
+}
+
+// chartStream packages a chart into a pipe as the request body is read from it.
+type chartStream struct {
+	*io.PipeReader
+	// size is the length of the package, or -1 if it is not known before it is sent.
+	size int64
+	// n and err are set when packaging stops.
+	n    int64
+	err  error
+	done chan struct{}
+}
+
+// streamChart starts packaging c in the background. The chart must not be changed until wait returns.
+func streamChart(p packager, c *chart.Chart, size int64) *chartStream {
+	pr, pw := io.Pipe()
+	s := &chartStream{PipeReader: pr, size: size, done: make(chan struct{})}
+
+	go func() {
+		defer close(s.done)
+		w := &countingWriter{Writer: pw}
+		s.err = p.Write(w, c)
+		s.n = w.n
+		pw.CloseWithError(s.err)
+	}()
+
+	return s
+}
+
+// wait stops packaging if the request has not read the whole package, and returns the number
+// of bytes that were packaged.
+func (s *chartStream) wait() (int64, error) {
+	s.PipeReader.Close()
+	<-s.done
+	return s.n, s.err
+}
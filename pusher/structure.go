@@ -0,0 +1,157 @@
+package pusher
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/wahabmk/helm-pusher/pkg/random"
+	"gopkg.in/yaml.v2"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+const (
+	subchartVersion = "0.1.0"
+)
+
+var (
+	templateBody = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Release.Name }}-%s
+  labels:
+    app.kubernetes.io/name: {{ .Chart.Name }}
+    app.kubernetes.io/instance: {{ .Release.Name }}
+data:
+  replicas: {{ .Values.replicaCount | default 1 | quote }}
+  generated: "%x"
+`
+)
+
+// Structure describes the content that is added to the template chart before it is pushed.
+type Structure struct {
+	// Templates is the number of templates added to the chart and to each of its subcharts.
+	Templates int
+	// ValuesSize is the approximate size in bytes of a generated values.yaml, which replaces
+	// the values of the chart and of each of its subcharts. Zero keeps the original values.
+	ValuesSize int64
+	// ValuesDepth is how deeply the generated values are nested.
+	ValuesDepth int
+	// Schema adds a values.schema.json that matches the values of the chart and of each of its subcharts.
+	Schema bool
+	// Subcharts is the number of subcharts embedded under charts/ at each level.
+	Subcharts int
+	// SubchartDepth is how many levels of subcharts are nested within each other. It is 1 if
+	// there are Subcharts and it is 0.
+	SubchartDepth int
+	// Lock adds a Chart.lock listing the subcharts.
+	Lock bool
+}
+
+func (s Structure) String() string {
+	return fmt.Sprintf("%d templates, %d byte values nested %d deep, values schema = %v, %d subcharts nested %d deep, Chart.lock = %v",
+		s.Templates, s.ValuesSize, s.ValuesDepth, s.Schema, s.Subcharts, s.SubchartDepth, s.Lock)
+}
+
+// WithStructure adds templates, values and subcharts to every chart that is pushed.
+func WithStructure(s Structure) Option {
+	return func(o *options) {
+		if s.Subcharts > 0 && s.SubchartDepth == 0 {
+			s.SubchartDepth = 1
+		}
+		o.structure = &s
+	}
+}
+
+// buildStructure adds the content described by s to c, descending into the subcharts that it creates.
+func buildStructure(entropy *random.Entropy, s *Structure, c *chart.Chart, depth int) error {
+
+	for i := 0; i < s.Templates; i++ {
+		name := fmt.Sprintf("generated-%d", i)
+		c.Templates = append(c.Templates, &chart.File{
+			Name: fmt.Sprintf("templates/%s.yaml", name),
+			Data: []byte(fmt.Sprintf(templateBody, name, entropy.Int63())),
+		})
+	}
+
+	if s.ValuesSize > 0 {
+		values := generateValues(entropy, s.ValuesSize, s.ValuesDepth)
+		data, err := yaml.Marshal(values)
+		if err != nil {
+			return fmt.Errorf("failed to marshal generated values: %w", err)
+		}
+		c.Values = values
+		c.Raw = withFile(c.Raw, &chart.File{Name: chartutil.ValuesfileName, Data: data})
+	}
+
+	if s.Schema {
+		schema, err := json.MarshalIndent(generateSchema(c.Name(), c.Values), "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal generated values schema: %w", err)
+		}
+		c.Schema = schema
+	}
+
+	if depth >= s.SubchartDepth {
+		return nil
+	}
+
+	for i := 0; i < s.Subcharts; i++ {
+		sub := &chart.Chart{
+			Metadata: &chart.Metadata{
+				APIVersion:  chart.APIVersionV2,
+				Name:        fmt.Sprintf("sub%d-%d", depth+1, i),
+				Version:     subchartVersion,
+				Description: "A generated subchart",
+				Type:        "application",
+			},
+			Raw: []*chart.File{{Name: chartutil.ValuesfileName, Data: []byte{}}},
+		}
+		if err := buildStructure(entropy, s, sub, depth+1); err != nil {
+			return err
+		}
+
+		c.AddDependency(sub)
+		c.Metadata.Dependencies = append(c.Metadata.Dependencies, &chart.Dependency{
+			Name:       sub.Name(),
+			Version:    sub.Metadata.Version,
+			Repository: fmt.Sprintf("file://%s/%s", chartutil.ChartsDir, sub.Name()),
+		})
+	}
+
+	if s.Lock && len(c.Metadata.Dependencies) > 0 {
+		lock, err := lockFor(c.Metadata.Dependencies)
+		if err != nil {
+			return err
+		}
+		c.Lock = lock
+	}
+
+	return nil
+}
+
+// lockFor returns a Chart.lock that locks deps.
+func lockFor(deps []*chart.Dependency) (*chart.Lock, error) {
+	digest, err := json.Marshal(deps)
+	if err != nil {
+		return nil, err
+	}
+	return &chart.Lock{
+		Generated:    time.Now(),
+		Digest:       fmt.Sprintf("sha256:%x", sha256.Sum256(digest)),
+		Dependencies: deps,
+	}, nil
+}
+
+// withFile returns files with f replacing any file that has the same name.
+func withFile(files []*chart.File, f *chart.File) []*chart.File {
+	out := make([]*chart.File, 0, len(files)+1)
+	for _, existing := range files {
+		if existing.Name != f.Name {
+			out = append(out, existing)
+		}
+	}
+	return append(out, f)
+}
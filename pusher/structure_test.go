@@ -0,0 +1,100 @@
+package pusher
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/wahabmk/helm-pusher/pkg/random"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+// structuredChart returns the scaffold with s added to it, packaged and loaded again.
+func structuredChart(t *testing.T, s Structure) (*routine, *chart.Chart) {
+	t.Helper()
+	r := newTestRoutine(t, scaffold(t), 1, WithStructure(s))
+	if err := buildStructure(random.New(1), r.opts.structure, r.chart, 0); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := r.opts.packager.Package(r.chart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loader.LoadArchive(buf)
+	if err != nil {
+		t.Fatalf("loading archive: %v", err)
+	}
+	return r, loaded
+}
+
+// checkStructure checks that c and its subcharts have the content of s, with depth levels of
+// subcharts below c.
+func checkStructure(t *testing.T, s Structure, c *chart.Chart, depth int) {
+	t.Helper()
+	deps := c.Dependencies()
+	want := 0
+	if depth > 0 {
+		want = s.Subcharts
+	}
+	if len(deps) != want || len(c.Metadata.Dependencies) != want {
+		t.Fatalf("%s has %d subcharts and %d dependencies, want %d", c.ChartFullPath(), len(deps), len(c.Metadata.Dependencies), want)
+	}
+
+	if s.Lock && want > 0 {
+		if c.Lock == nil {
+			t.Fatalf("%s has no Chart.lock", c.ChartFullPath())
+		}
+		locked := map[string]bool{}
+		for _, d := range c.Lock.Dependencies {
+			locked[d.Name+"-"+d.Version] = true
+		}
+		for _, sub := range deps {
+			if !locked[sub.Name()+"-"+sub.Metadata.Version] {
+				t.Errorf("%s does not lock %s", c.ChartFullPath(), sub.Name())
+			}
+		}
+	}
+
+	if s.Schema {
+		if len(c.Schema) == 0 {
+			t.Errorf("%s has no schema", c.ChartFullPath())
+		} else if err := chartutil.ValidateAgainstSingleSchema(c.Values, c.Schema); err != nil {
+			t.Errorf("values of %s do not conform to their schema: %v", c.ChartFullPath(), err)
+		}
+	}
+
+	generated := 0
+	for _, f := range c.Templates {
+		for i := 0; i < s.Templates; i++ {
+			if f.Name == fmt.Sprintf("templates/generated-%d.yaml", i) {
+				generated++
+			}
+		}
+	}
+	if generated != s.Templates {
+		t.Errorf("%s has %d generated templates, want %d", c.ChartFullPath(), generated, s.Templates)
+	}
+
+	for _, sub := range deps {
+		checkStructure(t, s, sub, depth-1)
+	}
+}
+
+func TestStructureLoads(t *testing.T) {
+	tests := []struct {
+		name      string
+		structure Structure
+		depth     int
+	}{
+		{"nested", Structure{Templates: 2, ValuesSize: 1 << 10, ValuesDepth: 2, Schema: true, Subcharts: 2, SubchartDepth: 2, Lock: true}, 2},
+		{"subcharts without depth", Structure{Subcharts: 3}, 1},
+		{"flat", Structure{Templates: 1, Schema: true}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, loaded := structuredChart(t, tt.structure)
+			checkStructure(t, *r.opts.structure, loaded, tt.depth)
+		})
+	}
+}
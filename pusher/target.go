@@ -0,0 +1,155 @@
+package pusher
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// Target is a registry that charts are pushed to. A Target is used by all routines at once.
+type Target interface {
+	// Push uploads the package of the chart with the given name and version, which is read from
+	// body and is size bytes long, or of unknown length if size is -1. Requests are sent with do.
+	// Responses with an unexpected status are returned as errors that describe the status.
+	Push(do Doer, name, version string, body io.Reader, size int64) error
+	// String describes the registry.
+	String() string
+}
+
+// Reporter is a Target that keeps stats of its own, which are printed with the results of a run.
+type Reporter interface {
+	// Report writes the stats of the Target to w.
+	Report(w io.Writer)
+}
+
+// Doer sends requests for a Target. Routines measure every request they send for a Target, for
+// which the body of each response must be closed.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// WithTarget pushes charts to t instead of to a ChartMuseum compatible API at the URL given to New.
+func WithTarget(t Target) Option {
+	return func(o *options) {
+		o.target = t
+	}
+}
+
+// Do sends req and accounts for it in the stats of the routine, once the body of the response is closed.
+func (r *routine) Do(req *http.Request) (*http.Response, error) {
+	r.stats.requests++
+	var body *requestBody
+	if req.Body != nil && req.Body != http.NoBody {
+		body = &requestBody{ReadCloser: req.Body}
+		req.Body = body
+	}
+
+	trace := &requestTrace{}
+	atomic.AddInt32(&r.inFlight, 1)
+	resp, err := httpClient.Do(trace.withTrace(req))
+	if err != nil {
+		atomic.AddInt32(&r.inFlight, -1)
+		r.countUpload(body)
+		return nil, err
+	}
+
+	resp.Body = &measuredBody{ReadCloser: resp.Body, r: r, trace: trace, upload: body}
+	return resp, nil
+}
+
+// countUpload accounts for the bytes of body that were sent, if the request had a body.
+func (r *routine) countUpload(body *requestBody) {
+	if body == nil {
+		return
+	}
+	n := atomic.LoadInt64(&body.n)
+	r.stats.bytesUp += n
+	r.stats.upload.add(n)
+}
+
+// requestBody is the body of a request, which counts the bytes that the transport reads from it.
+// Bodies of unknown length, and those that targets wrap, such as in multipart forms, are counted
+// as they are sent.
+type requestBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *requestBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	atomic.AddInt64(&b.n, int64(n))
+	return n, err
+}
+
+// measuredBody is the body of a response that is accounted for when it is closed.
+type measuredBody struct {
+	io.ReadCloser
+	r      *routine
+	trace  *requestTrace
+	upload *requestBody
+	n      int64
+	closed bool
+}
+
+func (b *measuredBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// Close drains what has not been read, so that it is accounted for and the connection can be reused.
+func (b *measuredBody) Close() error {
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+
+	_, err := io.Copy(ioutil.Discard, struct{ io.Reader }{b})
+	b.trace.finish()
+	atomic.AddInt32(&b.r.inFlight, -1)
+	b.r.stats.timing.add(b.trace)
+	b.r.stats.bytesDown += b.n
+	b.r.stats.download.add(b.n)
+	b.r.countUpload(b.upload)
+
+	if cerr := b.ReadCloser.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// statusError is returned when a request completes with an unexpected status, along with the
+// error that the registry describes in the body of the response, if it is known.
+type statusError struct {
+	code    int
+	message string
+	// kind identifies the error that the registry describes, such as by its error codes, without
+	// the details of the message that differ between charts.
+	kind string
+}
+
+func (e *statusError) Error() string {
+	if e.message == "" {
+		return fmt.Sprintf("returned with status %d", e.code)
+	}
+	return fmt.Sprintf("returned with status %d: %s", e.code, e.message)
+}
+
+// errorKind returns the kind of err, which is its message, but with the message of a status
+// error replaced by its status and kind, so that errors that only differ by the chart that they
+// are about are of the same kind.
+func errorKind(err error) string {
+	var se *statusError
+	if !errors.As(err, &se) || se.message == "" {
+		return err.Error()
+	}
+	kind := fmt.Sprintf("returned with status %d", se.code)
+	if se.kind != "" {
+		kind += ": " + se.kind
+	}
+	return strings.Replace(err.Error(), se.Error(), kind, 1)
+}
@@ -0,0 +1,102 @@
+package pusher
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+// recordingTarget loads every chart pushed to it, and fails every failEvery-th push if it is set.
+type recordingTarget struct {
+	failEvery int
+
+	mu     sync.Mutex
+	pushes int
+	pushed map[string]int
+	errs   []error
+}
+
+func (t *recordingTarget) Push(_ Doer, name, version string, body io.Reader, size int64) error {
+	c, err := loader.LoadArchive(body)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case err != nil:
+		t.errs = append(t.errs, fmt.Errorf("%s-%s: %w", name, version, err))
+	case c.Name() != name || c.Metadata.Version != version:
+		t.errs = append(t.errs, fmt.Errorf("pushed %s-%s as %s-%s", c.Name(), c.Metadata.Version, name, version))
+	case size < 0:
+		t.errs = append(t.errs, fmt.Errorf("%s-%s was pushed with unknown size", name, version))
+	}
+	if t.pushed == nil {
+		t.pushed = map[string]int{}
+	}
+	t.pushed[name+"-"+version]++
+	t.pushes++
+	if t.failEvery > 0 && t.pushes%t.failEvery == 0 {
+		return &statusError{code: http.StatusInternalServerError}
+	}
+	return nil
+}
+
+func (t *recordingTarget) String() string {
+	return "recording"
+}
+
+func TestRoutinesPushToTarget(t *testing.T) {
+	const nRoutines, nCharts = 4, 10
+	target := &recordingTarget{}
+	p := &Pusher{nCharts: nRoutines * nCharts, nRoutines: nRoutines}
+	routines := make([]*routine, nRoutines)
+	c := scaffold(t)
+	for i := range routines {
+		routines[i] = newTestRoutine(t, copyChart(c), nCharts, WithTarget(target))
+		routines[i].id = int64(i)
+	}
+
+	p.run(routines, false, false, func(r *routine) {
+		r.push(3)
+	})
+
+	for _, err := range target.errs {
+		t.Error(err)
+	}
+	if len(target.pushed) != nRoutines*nCharts {
+		t.Errorf("%d charts pushed, want %d", len(target.pushed), nRoutines*nCharts)
+	}
+	for chart, n := range target.pushed {
+		if n != 1 {
+			t.Errorf("%s pushed %d times", chart, n)
+		}
+	}
+	for _, r := range routines {
+		if r.errors != 0 || r.completed != nCharts {
+			t.Errorf("routine %d made %d attempts with %d errors, want %d without errors", r.id, r.completed, r.errors, nCharts)
+		}
+	}
+}
+
+func TestRoutineRecordsTargetErrors(t *testing.T) {
+	target := &recordingTarget{failEvery: 2}
+	r := newTestRoutine(t, scaffold(t), 10, WithTarget(target))
+	r.push(1)
+
+	if target.pushes != 10 {
+		t.Fatalf("%d charts pushed, want 10", target.pushes)
+	}
+	if r.errors != 5 || len(r.errorKinds) != 1 {
+		t.Errorf("recorded %d errors of %d kinds, want 5 of 1", r.errors, len(r.errorKinds))
+	}
+	var pushed int64
+	for _, n := range r.stats.versionsPerChart {
+		pushed += n
+	}
+	if pushed != 5 {
+		t.Errorf("%d versions counted as pushed, want 5", pushed)
+	}
+}
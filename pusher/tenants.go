@@ -0,0 +1,148 @@
+package pusher
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// busiestTenants is how many tenants the stats of each are printed for.
+const busiestTenants = 10
+
+// tenants spreads charts across the repositories of a multitenant ChartMuseum, which serves them
+// under /api/<tenant>/charts, and keeps stats of each.
+type tenants struct {
+	once sync.Once
+	// cumulative has the cumulative share of charts of each tenant.
+	cumulative []float64
+
+	mu    sync.Mutex
+	stats map[int]*tenantStats
+}
+
+// tenantStats has the pushes to a tenant.
+type tenantStats struct {
+	pushes  int64
+	errors  int64
+	bytes   int64
+	latency histogram
+}
+
+// tenant returns the index of the tenant that the chart with the given name is pushed to. Every
+// version of a chart is pushed to the same tenant. Tenant i gets a share of charts proportional
+// to 1/(i+1)^skew, so with a skew of 0 every tenant gets the same share.
+func (t *ChartMuseum) tenant(name string) int {
+	t.tenants.once.Do(func() {
+		weights := make([]float64, t.Tenants)
+		var total float64
+		for i := range weights {
+			total += 1 / math.Pow(float64(i+1), t.TenantSkew)
+			weights[i] = total
+		}
+		for i := range weights {
+			weights[i] /= total
+		}
+		t.tenants.cumulative = weights
+	})
+
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	// The high bits of FNV hashes of names that differ only at the end, such as chart1 and
+	// chart2, are hardly mixed, so they are mixed with the finalizer of SplitMix64 first.
+	x := h.Sum64()
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	x ^= x >> 31
+	u := float64(x>>11) / (1 << 53)
+	i := sort.SearchFloat64s(t.tenants.cumulative, u)
+	if i >= t.Tenants {
+		i = t.Tenants - 1
+	}
+	return i
+}
+
+// tenantPath returns the path of tenant i, such as org3/repo17 for a depth of 2. The segments
+// above the last count organisations, so that tenants are spread across as few of them as needed.
+func (t *ChartMuseum) tenantPath(i int) string {
+	depth := t.TenantDepth
+	if depth < 1 {
+		depth = 1
+	}
+	base := int(math.Ceil(math.Pow(float64(t.Tenants), 1/float64(depth))))
+	if base < 2 {
+		base = 2
+	}
+
+	segments := make([]string, depth)
+	segments[depth-1] = fmt.Sprintf("repo%d", i)
+	for d := depth - 2; d >= 0; d-- {
+		i /= base
+		segments[d] = fmt.Sprintf("org%d", i%base)
+	}
+	return strings.Join(segments, "/")
+}
+
+// record accounts for a push of size bytes to tenant i.
+func (ts *tenants) record(i int, size int64, elapsed time.Duration, err error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.stats == nil {
+		ts.stats = map[int]*tenantStats{}
+	}
+	s, ok := ts.stats[i]
+	if !ok {
+		s = &tenantStats{}
+		ts.stats[i] = s
+	}
+
+	s.pushes++
+	if err != nil {
+		s.errors++
+	}
+	if size > 0 {
+		s.bytes += size
+	}
+	s.latency.add(int64(elapsed))
+}
+
+// Report writes the stats of the tenants that charts were pushed to, if there are any, to w.
+func (t *ChartMuseum) Report(w io.Writer) {
+	ts := &t.tenants
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if t.Tenants == 0 || len(ts.stats) == 0 {
+		return
+	}
+
+	var pushes histogram
+	busiest := make([]int, 0, len(ts.stats))
+	for i, s := range ts.stats {
+		pushes.add(s.pushes)
+		busiest = append(busiest, i)
+	}
+	sort.Slice(busiest, func(a, b int) bool {
+		sa, sb := ts.stats[busiest[a]], ts.stats[busiest[b]]
+		if sa.pushes != sb.pushes {
+			return sa.pushes > sb.pushes
+		}
+		return busiest[a] < busiest[b]
+	})
+	if len(busiest) > busiestTenants {
+		busiest = busiest[:busiestTenants]
+	}
+
+	fmt.Fprintf(w, "* Tenants pushed to: %d of %d\n", len(ts.stats), t.Tenants)
+	fmt.Fprintf(w, "* Pushes per tenant: %s\n", pushes.summary(formatCount))
+	fmt.Fprintf(w, "* Busiest tenants:\n")
+	for _, i := range busiest {
+		s := ts.stats[i]
+		sort.Slice(s.latency, func(a, b int) bool { return s.latency[a] < s.latency[b] })
+		fmt.Fprintf(w, "\t%s: %d pushes, %d errors, %s, latency p50 %s, p99 %s\n", t.tenantPath(i), s.pushes, s.errors,
+			formatBytes(s.bytes), formatDuration(s.latency.percentile(50)), formatDuration(s.latency.percentile(99)))
+	}
+}
@@ -0,0 +1,153 @@
+package pusher
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTenantSkew(t *testing.T) {
+	const names = 20000
+	for _, skew := range []float64{0, 1, 2} {
+		target := &ChartMuseum{Tenants: 10, TenantSkew: skew}
+		counts := make([]int, target.Tenants)
+		for n := 0; n < names; n++ {
+			name := fmt.Sprintf("chart%d", n)
+			i := target.tenant(name)
+			if i < 0 || i >= target.Tenants {
+				t.Fatalf("tenant of %s is %d with a skew of %.0f, want one of %d", name, i, skew, target.Tenants)
+			}
+			if again := target.tenant(name); again != i {
+				t.Fatalf("tenant of %s is %d and then %d, want the same", name, i, again)
+			}
+			counts[i]++
+		}
+
+		var total float64
+		for i := range counts {
+			total += 1 / math.Pow(float64(i+1), skew)
+		}
+		for i, count := range counts {
+			want := 1 / math.Pow(float64(i+1), skew) / total
+			if got := float64(count) / names; math.Abs(got-want) > 0.015 {
+				t.Errorf("tenant %d has a share of %.3f with a skew of %.0f, want %.3f", i, got, skew, want)
+			}
+		}
+	}
+}
+
+func TestTenantPath(t *testing.T) {
+	tests := []struct {
+		tenants, depth, i int
+		want              string
+	}{
+		{100, 0, 17, "repo17"},
+		{100, 1, 17, "repo17"},
+		{100, 2, 17, "org1/repo17"},
+		{100, 2, 99, "org9/repo99"},
+		{100, 3, 17, "org0/org3/repo17"},
+		{1, 2, 0, "org0/repo0"},
+		{3, 2, 2, "org1/repo2"},
+	}
+	for _, tt := range tests {
+		target := &ChartMuseum{Tenants: tt.tenants, TenantDepth: tt.depth}
+		if got := target.tenantPath(tt.i); got != tt.want {
+			t.Errorf("path of tenant %d of %d, %d levels deep, is %s, want %s", tt.i, tt.tenants, tt.depth, got, tt.want)
+		}
+	}
+
+	// Paths have as many segments as levels, and tenants are spread across as few organisations
+	// as needed.
+	target := &ChartMuseum{Tenants: 1000, TenantDepth: 4}
+	orgs := map[string]bool{}
+	for i := 0; i < target.Tenants; i++ {
+		p := target.tenantPath(i)
+		if segments := strings.Count(p, "/") + 1; segments != target.TenantDepth {
+			t.Errorf("path of tenant %d is %s, want %d segments", i, p, target.TenantDepth)
+		}
+		orgs[p[:strings.LastIndex(p, "/")]] = true
+	}
+	// With 6 organisations at each of 3 levels, 6^4 >= 1000 tenants fit.
+	if len(orgs) > 6*6*6 {
+		t.Errorf("tenants are spread across %d organisations, want at most %d", len(orgs), 6*6*6)
+	}
+}
+
+func TestTenantPush(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		bodies = map[string]string{}
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		bodies[req.URL.Path] = string(body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+	target := NewChartMuseum(server.URL+"/api/charts", "", "")
+	target.Tenants, target.TenantDepth = 100, 2
+
+	// Streamed charts are counted as they are sent.
+	for _, size := range []int64{5, -1} {
+		if err := target.Push(httpClient, "chart", "0.1.0", ioutil.NopCloser(strings.NewReader("chart")), size); err != nil {
+			t.Fatal(err)
+		}
+	}
+	i := target.tenant("chart")
+	path := "/api/" + target.tenantPath(i) + "/charts"
+	if bodies[path] != "chart" {
+		t.Errorf("pushed %v, want the chart at %s", bodies, path)
+	}
+	if s := target.tenants.stats[i]; s.pushes != 2 || s.bytes != 10 {
+		t.Errorf("tenant %d has %d pushes of %d bytes, want 2 of 10", i, s.pushes, s.bytes)
+	}
+}
+
+func TestTenantReport(t *testing.T) {
+	target := &ChartMuseum{Tenants: 20}
+	pushes := map[int]int{7: 9, 1: 5, 3: 5}
+	for i := 0; i < 12; i++ {
+		if _, ok := pushes[i]; !ok {
+			pushes[i] = 1
+		}
+	}
+	for i, n := range pushes {
+		for p := 0; p < n; p++ {
+			var err error
+			if p == 0 {
+				err = fmt.Errorf("failed")
+			}
+			target.tenants.record(i, 100, time.Millisecond, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	target.Report(&buf)
+	var busiest []string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.HasPrefix(line, "\t") {
+			busiest = append(busiest, strings.SplitN(strings.TrimSpace(line), ",", 2)[0])
+		}
+	}
+	// Tenants with as many pushes are ranked by index, and only the busiest are listed.
+	want := []string{"repo7: 9 pushes", "repo1: 5 pushes", "repo3: 5 pushes", "repo0: 1 pushes", "repo2: 1 pushes",
+		"repo4: 1 pushes", "repo5: 1 pushes", "repo6: 1 pushes", "repo8: 1 pushes", "repo9: 1 pushes"}
+	if strings.Join(busiest, "\n") != strings.Join(want, "\n") {
+		t.Errorf("busiest tenants are %q, want %q", busiest, want)
+	}
+	if !strings.Contains(buf.String(), "* Tenants pushed to: 12 of 20\n") {
+		t.Errorf("report does not have the tenants pushed to:\n%s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "\trepo7: 9 pushes, 1 errors, 900 B,") {
+		t.Errorf("report does not have the errors and bytes of repo7:\n%s", buf.String())
+	}
+}
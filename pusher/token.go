@@ -0,0 +1,291 @@
+package pusher
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultTokenExpiry is how long tokens are valid for when the token server does not say.
+	defaultTokenExpiry = 60 * time.Second
+	// tokenExpiryMargin is how long before they expire that tokens are refreshed, so that they do
+	// not expire while a request is sent.
+	tokenExpiryMargin = 5 * time.Second
+)
+
+// token is a bearer token for a scope of a registry.
+type token struct {
+	value   string
+	expires time.Time
+}
+
+// tokenFetch is a request for a token that is in flight. Its token and err are set when done is closed.
+type tokenFetch struct {
+	token
+	err  error
+	done chan struct{}
+}
+
+// tokens caches the bearer tokens of a registry by scope, and keeps stats of the token server.
+type tokens struct {
+	mu      sync.Mutex
+	byScope map[string]token
+	// fetching has the fetches that are in flight, by scope.
+	fetching map[string]*tokenFetch
+	// challenges has the challenge that was last answered for each repository, so that requests to
+	// it send a token before they are challenged again.
+	challenges map[string]challenge
+
+	fetched   int64
+	refreshed int64
+	reused    int64
+	// waited counts the tokens that were taken from a fetch in flight instead of being fetched again.
+	waited  int64
+	latency histogram
+}
+
+// challenge is a Bearer challenge of a WWW-Authenticate header.
+type challenge struct {
+	realm   string
+	service string
+	scope   string
+}
+
+// parseChallenge parses a WWW-Authenticate header such as
+// `Bearer realm="https://auth.example.com/token",service="registry.example.com",scope="repository:charts/a:pull"`.
+// It reports false if the header is not a Bearer challenge.
+func parseChallenge(header string) (challenge, bool) {
+	scheme, params := header, ""
+	if i := strings.IndexByte(header, ' '); i >= 0 {
+		scheme, params = header[:i], header[i+1:]
+	}
+	if !strings.EqualFold(scheme, "Bearer") {
+		return challenge{}, false
+	}
+
+	c := challenge{}
+	for params != "" {
+		params = strings.TrimLeft(params, " ,")
+		i := strings.IndexByte(params, '=')
+		if i < 0 {
+			break
+		}
+		key, value := strings.TrimSpace(params[:i]), ""
+		params = params[i+1:]
+		if strings.HasPrefix(params, `"`) {
+			// Quoted values, such as scopes with several actions, can contain commas.
+			if end := strings.IndexByte(params[1:], '"'); end >= 0 {
+				value, params = params[1:end+1], params[end+2:]
+			} else {
+				value, params = params[1:], ""
+			}
+		} else {
+			end := strings.IndexByte(params, ',')
+			if end < 0 {
+				end = len(params)
+			}
+			value, params = params[:end], params[end:]
+		}
+
+		switch strings.ToLower(key) {
+		case "realm":
+			c.realm = value
+		case "service":
+			c.service = value
+		case "scope":
+			c.scope = value
+		}
+	}
+	return c, c.realm != ""
+}
+
+// authorized returns a Doer that sends requests to repo with a bearer token, if the registry has
+// challenged requests to repo before, and that answers the challenges of the registry.
+func (t *OCI) authorized(do Doer, repo string) Doer {
+	return &tokenDoer{t: t, do: do, repo: repo}
+}
+
+// tokenDoer sends requests to a repository of an OCI registry with bearer tokens.
+type tokenDoer struct {
+	t    *OCI
+	do   Doer
+	repo string
+}
+
+// Do sends req, with a token if there is one for the repository. If the registry challenges it,
+// Do gets a token for the scope of the challenge and sends req again with it, if its body can
+// be sent again.
+func (d *tokenDoer) Do(req *http.Request) (*http.Response, error) {
+	t := d.t
+	answered, sent := t.tokens.challenge(d.repo)
+	var value string
+	if sent {
+		var err error
+		if value, err = t.token(answered, ""); err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+value)
+	}
+
+	resp, err := d.do.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	c, ok := parseChallenge(resp.Header.Get("WWW-Authenticate"))
+	if !ok || (req.Body != nil && req.GetBody == nil) {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	// A token that was sent for the same scope is refreshed, since the registry no longer accepts it.
+	stale := ""
+	if sent && c == answered {
+		stale = value
+	}
+	value, err = t.token(c, stale)
+	if err != nil {
+		return nil, err
+	}
+	t.tokens.answered(d.repo, c)
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	retry.Header.Set("Authorization", "Bearer "+value)
+	return d.do.Do(retry)
+}
+
+func (ts *tokens) challenge(repo string) (challenge, bool) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	c, ok := ts.challenges[repo]
+	return c, ok
+}
+
+func (ts *tokens) answered(repo string, c challenge) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.challenges == nil {
+		ts.challenges = map[string]challenge{}
+	}
+	ts.challenges[repo] = c
+}
+
+// token returns the cached token for the scope of c, or gets one from the token server if there
+// is none, it is about to expire, or it is stale, which is a token the registry no longer accepts.
+// Routines that need a token for a scope that is being fetched wait for that fetch.
+func (t *OCI) token(c challenge, stale string) (string, error) {
+	ts := &t.tokens
+	ts.mu.Lock()
+	cached, ok := ts.byScope[c.scope]
+	if ok && cached.value != stale && time.Now().Add(tokenExpiryMargin).Before(cached.expires) {
+		ts.reused++
+		ts.mu.Unlock()
+		return cached.value, nil
+	}
+	if f, fetching := ts.fetching[c.scope]; fetching {
+		ts.waited++
+		ts.mu.Unlock()
+		<-f.done
+		return f.value, f.err
+	}
+	f := &tokenFetch{done: make(chan struct{})}
+	if ts.fetching == nil {
+		ts.fetching = map[string]*tokenFetch{}
+	}
+	ts.fetching[c.scope] = f
+	ts.mu.Unlock()
+
+	start := time.Now()
+	f.token, f.err = t.fetchToken(c)
+	if f.err != nil {
+		f.err = fmt.Errorf("failed to get token for %q: %w", c.scope, f.err)
+	}
+
+	ts.mu.Lock()
+	delete(ts.fetching, c.scope)
+	if f.err == nil {
+		if ts.byScope == nil {
+			ts.byScope = map[string]token{}
+		}
+		ts.byScope[c.scope] = f.token
+		ts.fetched++
+		if ok {
+			ts.refreshed++
+		}
+		ts.latency.add(int64(time.Since(start)))
+	}
+	ts.mu.Unlock()
+	close(f.done)
+	return f.value, f.err
+}
+
+// fetchToken gets a token for the scope of c from the token server of c, with the credentials of
+// the registry if it has any. Token requests are not sent by routines, so that they are not
+// measured as requests to the registry.
+func (t *OCI) fetchToken(c challenge) (token, error) {
+	u, err := url.Parse(c.realm)
+	if err != nil {
+		return token{}, err
+	}
+	q := u.Query()
+	if c.service != "" {
+		q.Set("service", c.service)
+	}
+	if c.scope != "" {
+		q.Set("scope", c.scope)
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := t.newRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return token{}, err
+	}
+	body := struct {
+		Token       string    `json:"token"`
+		AccessToken string    `json:"access_token"`
+		ExpiresIn   int64     `json:"expires_in"`
+		IssuedAt    time.Time `json:"issued_at"`
+	}{}
+	if err := t.getJSON(httpClient, req, &body); err != nil {
+		return token{}, err
+	}
+
+	tok := token{value: body.Token}
+	if tok.value == "" {
+		tok.value = body.AccessToken
+	}
+	if tok.value == "" {
+		return token{}, fmt.Errorf("token server returned no token")
+	}
+	expiry := defaultTokenExpiry
+	if body.ExpiresIn > 0 {
+		expiry = time.Duration(body.ExpiresIn) * time.Second
+	}
+	issued := time.Now()
+	if !body.IssuedAt.IsZero() && body.IssuedAt.Before(issued) {
+		issued = body.IssuedAt
+	}
+	tok.expires = issued.Add(expiry)
+	return tok, nil
+}
+
+// report writes the stats of the token server to w, if any tokens were used.
+func (ts *tokens) report(w io.Writer) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.fetched == 0 {
+		return
+	}
+	fmt.Fprintf(w, "* OCI tokens: %d fetched, %d of them refreshed, %d reused from the cache, %d taken from a fetch in flight\n",
+		ts.fetched, ts.refreshed, ts.reused, ts.waited)
+	fmt.Fprintf(w, "* OCI token server latency: %s\n", ts.latency.summary(formatDuration))
+}
@@ -0,0 +1,173 @@
+package pusher
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseChallenge(t *testing.T) {
+	tests := []struct {
+		header string
+		want   challenge
+		ok     bool
+	}{
+		{
+			header: `Bearer realm="https://auth.example.com/token",service="registry.example.com",scope="repository:charts/a:pull,push"`,
+			want:   challenge{realm: "https://auth.example.com/token", service: "registry.example.com", scope: "repository:charts/a:pull,push"},
+			ok:     true,
+		},
+		{
+			header: `bearer realm=https://auth.example.com/token, scope="repository:a:pull"`,
+			want:   challenge{realm: "https://auth.example.com/token", scope: "repository:a:pull"},
+			ok:     true,
+		},
+		{header: `Basic realm="registry"`},
+		{header: `Bearer service="registry.example.com"`, want: challenge{service: "registry.example.com"}},
+		{header: ""},
+	}
+	for _, tt := range tests {
+		got, ok := parseChallenge(tt.header)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseChallenge(%q) = %+v, %v, want %+v, %v", tt.header, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// tokenRegistry is a registry that challenges requests without the latest token it issued, and
+// the token server that issues them.
+type tokenRegistry struct {
+	*httptest.Server
+	// delay is how long the token server takes to issue a token.
+	delay time.Duration
+
+	issued     int64
+	challenged int64
+}
+
+func newTokenRegistry() *tokenRegistry {
+	reg := &tokenRegistry{}
+	reg.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/token" {
+			time.Sleep(reg.delay)
+			n := atomic.AddInt64(&reg.issued, 1)
+			fmt.Fprintf(w, `{"token":"token-%d","expires_in":300}`, n)
+			return
+		}
+
+		if req.Header.Get("Authorization") != fmt.Sprintf("Bearer token-%d", atomic.LoadInt64(&reg.issued)) {
+			atomic.AddInt64(&reg.challenged, 1)
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test",scope="repository:%s:pull"`,
+				reg.URL, strings.TrimPrefix(req.URL.Path, "/v2/")))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		io.Copy(ioutil.Discard, req.Body)
+	}))
+	return reg
+}
+
+func (reg *tokenRegistry) send(t *testing.T, oci *OCI, repo string, body io.Reader) int {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPut, reg.URL+"/v2/"+repo, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := oci.authorized(httpClient, repo).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestTokenIsReusedAndRefreshed(t *testing.T) {
+	reg := newTokenRegistry()
+	defer reg.Close()
+	oci := NewOCI(reg.URL, "charts", "", "")
+
+	for i := 0; i < 3; i++ {
+		if code := reg.send(t, oci, "charts/a", nil); code != http.StatusOK {
+			t.Fatalf("request %d completed with %d", i, code)
+		}
+	}
+	if reg.issued != 1 || reg.challenged != 1 || oci.tokens.reused != 2 {
+		t.Errorf("%d tokens issued, %d requests challenged, %d tokens reused, want 1, 1 and 2", reg.issued, reg.challenged, oci.tokens.reused)
+	}
+
+	// A token that is about to expire is refreshed before it is sent.
+	scope := "repository:charts/a:pull"
+	oci.tokens.byScope[scope] = token{value: oci.tokens.byScope[scope].value, expires: time.Now()}
+	if code := reg.send(t, oci, "charts/a", nil); code != http.StatusOK {
+		t.Fatalf("request with an expired token completed with %d", code)
+	}
+	if reg.issued != 2 || reg.challenged != 1 || oci.tokens.refreshed != 1 {
+		t.Errorf("%d tokens issued, %d requests challenged, %d refreshed, want 2, 1 and 1", reg.issued, reg.challenged, oci.tokens.refreshed)
+	}
+
+	// A token that the registry no longer accepts is refreshed when it is challenged.
+	atomic.AddInt64(&reg.issued, 1)
+	if code := reg.send(t, oci, "charts/a", nil); code != http.StatusOK {
+		t.Fatalf("request with a revoked token completed with %d", code)
+	}
+	if reg.issued != 4 || reg.challenged != 2 || oci.tokens.refreshed != 2 {
+		t.Errorf("%d tokens issued, %d requests challenged, %d refreshed, want 4, 2 and 2", reg.issued, reg.challenged, oci.tokens.refreshed)
+	}
+}
+
+func TestTokenRetryNeedsGetBody(t *testing.T) {
+	reg := newTokenRegistry()
+	defer reg.Close()
+	oci := NewOCI(reg.URL, "charts", "", "")
+
+	// Requests made with a bytes.Reader can get their body again, so they are retried with a token.
+	if code := reg.send(t, oci, "charts/a", bytes.NewReader([]byte("chart"))); code != http.StatusOK {
+		t.Errorf("request with a replayable body completed with %d, want 200", code)
+	}
+	if code := reg.send(t, oci, "charts/b", io.MultiReader(strings.NewReader("chart"))); code != http.StatusUnauthorized {
+		t.Errorf("request with a body that cannot be replayed completed with %d, want 401", code)
+	}
+	if reg.issued != 1 {
+		t.Errorf("%d tokens issued, want 1", reg.issued)
+	}
+}
+
+func TestConcurrentTokenFetchesAreShared(t *testing.T) {
+	reg := newTokenRegistry()
+	reg.delay = 50 * time.Millisecond
+	defer reg.Close()
+	oci := NewOCI(reg.URL, "charts", "", "")
+
+	c := challenge{realm: reg.URL + "/token", service: "test", scope: "repository:charts/a:pull"}
+	var wg sync.WaitGroup
+	values := make([]string, 8)
+	for i := range values {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			value, err := oci.token(c, "")
+			if err != nil {
+				t.Error(err)
+			}
+			values[i] = value
+		}(i)
+	}
+	wg.Wait()
+
+	if reg.issued != 1 {
+		t.Errorf("%d tokens issued, want 1", reg.issued)
+	}
+	for _, value := range values {
+		if value != "token-1" {
+			t.Errorf("got token %q, want token-1", value)
+		}
+	}
+}
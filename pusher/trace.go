@@ -0,0 +1,147 @@
+package pusher
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// requestTrace records when each phase of a single request started and finished. The transport
+// can call back from other go-routines, such as for a dial that it started for the request but
+// that finishes after the request got a pooled connection instead, so the phases are only read
+// once the trace is finished, and callbacks after that are ignored.
+type requestTrace struct {
+	mu       sync.Mutex
+	finished bool
+
+	start        time.Time
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	wroteHeaders time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+	done         time.Time
+	reused       bool
+}
+
+// withTrace returns a shallow copy of req which records its phases in t.
+func (t *requestTrace) withTrace(req *http.Request) *http.Request {
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { t.stamp(&t.dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { t.stamp(&t.dnsDone) },
+		ConnectStart: func(string, string) {
+			t.record(func() {
+				// With multiple addresses only the first dial is accounted for.
+				if t.connectStart.IsZero() {
+					t.connectStart = time.Now()
+				}
+			})
+		},
+		ConnectDone:          func(string, string, error) { t.stamp(&t.connectDone) },
+		TLSHandshakeStart:    func() { t.stamp(&t.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { t.stamp(&t.tlsDone) },
+		GotConn:              func(info httptrace.GotConnInfo) { t.record(func() { t.reused = info.Reused }) },
+		WroteHeaders:         func() { t.stamp(&t.wroteHeaders) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { t.stamp(&t.wroteRequest) },
+		GotFirstResponseByte: func() { t.stamp(&t.firstByte) },
+	}
+
+	t.start = time.Now()
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+}
+
+// record runs f, which sets phases of the trace, unless the trace is finished.
+func (t *requestTrace) record(f func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.finished {
+		f()
+	}
+}
+
+// stamp sets the phase at to now, unless the trace is finished.
+func (t *requestTrace) stamp(at *time.Time) {
+	t.record(func() { *at = time.Now() })
+}
+
+// finish records that the request is done. The phases of the trace do not change after it.
+func (t *requestTrace) finish() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.done = time.Now()
+	t.finished = true
+}
+
+// traceStats has the latency of each request phase and how often connections were reused.
+type traceStats struct {
+	dns         histogram
+	connect     histogram
+	tls         histogram
+	upload      histogram
+	wait        histogram
+	download    histogram
+	total       histogram
+	connsNew    int64
+	connsReused int64
+}
+
+// add accounts for a request whose trace is finished. Phases that did not happen, such as DNS lookups on
+// reused connections, are not recorded.
+func (s *traceStats) add(t *requestTrace) {
+	if t.reused {
+		s.connsReused++
+	} else {
+		s.connsNew++
+	}
+
+	s.addPhase(&s.dns, t.dnsStart, t.dnsDone)
+	s.addPhase(&s.connect, t.connectStart, t.connectDone)
+	s.addPhase(&s.tls, t.tlsStart, t.tlsDone)
+	s.addPhase(&s.upload, t.wroteHeaders, t.wroteRequest)
+	s.addPhase(&s.wait, t.wroteRequest, t.firstByte)
+	s.addPhase(&s.download, t.firstByte, t.done)
+	s.addPhase(&s.total, t.start, t.done)
+}
+
+func (s *traceStats) addPhase(h *histogram, start, end time.Time) {
+	if start.IsZero() || end.IsZero() {
+		return
+	}
+	h.add(int64(end.Sub(start)))
+}
+
+func (s *traceStats) merge(s2 *traceStats) {
+	s.dns.merge(s2.dns)
+	s.connect.merge(s2.connect)
+	s.tls.merge(s2.tls)
+	s.upload.merge(s2.upload)
+	s.wait.merge(s2.wait)
+	s.download.merge(s2.download)
+	s.total.merge(s2.total)
+	s.connsNew += s2.connsNew
+	s.connsReused += s2.connsReused
+}
+
+func (s *traceStats) print(w io.Writer) {
+	fmt.Fprintf(w, "* Connections: %d new, %d reused (%.2f perc)\n", s.connsNew, s.connsReused, percent(s.connsReused, s.connsNew+s.connsReused))
+	fmt.Fprintf(w, "* Request phase latencies:\n")
+	fmt.Fprintf(w, "\tDNS lookup:     %s\n", s.dns.summary(formatDuration))
+	fmt.Fprintf(w, "\tTCP connect:    %s\n", s.connect.summary(formatDuration))
+	fmt.Fprintf(w, "\tTLS handshake:  %s\n", s.tls.summary(formatDuration))
+	fmt.Fprintf(w, "\tUpload body:    %s\n", s.upload.summary(formatDuration))
+	fmt.Fprintf(w, "\tServer wait:    %s\n", s.wait.summary(formatDuration))
+	fmt.Fprintf(w, "\tDownload body:  %s\n", s.download.summary(formatDuration))
+	fmt.Fprintf(w, "\tTotal:          %s\n", s.total.summary(formatDuration))
+}
+
+func formatDuration(d int64) string {
+	return time.Duration(d).Round(time.Microsecond).String()
+}
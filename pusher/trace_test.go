@@ -0,0 +1,38 @@
+package pusher
+
+import (
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"testing"
+)
+
+func TestTraceIgnoresCallbacksAfterFinish(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trace := &requestTrace{}
+	ct := httptrace.ContextClientTrace(trace.withTrace(req).Context())
+	ct.GotConn(httptrace.GotConnInfo{Reused: true})
+	trace.finish()
+
+	// A dial that the transport started for the request can finish after it, in another go-routine.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ct.ConnectStart("tcp", "127.0.0.1:80")
+		ct.ConnectDone("tcp", "127.0.0.1:80", nil)
+	}()
+	var s traceStats
+	s.add(trace)
+	wg.Wait()
+
+	if !trace.connectStart.IsZero() || !trace.connectDone.IsZero() {
+		t.Errorf("connect phase recorded after the trace finished")
+	}
+	if s.connsReused != 1 || len(s.connect) != 0 || len(s.total) != 1 {
+		t.Errorf("stats are %+v, want a reused connection without a connect phase", s)
+	}
+}
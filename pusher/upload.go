@@ -0,0 +1,155 @@
+package pusher
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+)
+
+// pushBlob uploads data to repo, unless the registry already has it, or mounts it from another
+// repository that it was pushed to if Mount is set.
+func (t *OCI) pushBlob(do Doer, repo, digest string, data []byte) error {
+	req, err := t.newRequest(http.MethodHead, t.endpoint(repo, "blobs", digest), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := do.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		atomic.AddInt64(&t.blobsExisting, 1)
+		t.pushedTo(repo, digest)
+		return nil
+	case http.StatusNotFound:
+	default:
+		return &statusError{code: resp.StatusCode}
+	}
+
+	location, err := t.startUpload(do, repo, digest)
+	if err != nil || location == nil {
+		return err
+	}
+	if t.ChunkSize > 0 {
+		err = t.uploadChunks(do, location, digest, data)
+	} else {
+		err = t.completeUpload(do, location, digest, data)
+	}
+	if err != nil {
+		return err
+	}
+	atomic.AddInt64(&t.blobsUploaded, 1)
+	t.pushedTo(repo, digest)
+	return nil
+}
+
+// startUpload starts an upload of the blob with the given digest to repo, and returns the URL
+// that it continues at. If the blob is mounted from another repository instead, it returns nil.
+func (t *OCI) startUpload(do Doer, repo, digest string) (*url.URL, error) {
+	u := t.endpoint(repo, "blobs", "uploads") + "/"
+	if t.Mount {
+		if from := t.source(digest); from != "" && from != repo {
+			u += "?" + url.Values{"mount": {digest}, "from": {from}}.Encode()
+		}
+	}
+	req, err := t.newRequest(http.MethodPost, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := do.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusCreated && req.URL.Query().Get("mount") != "":
+		atomic.AddInt64(&t.mountsAccepted, 1)
+		t.pushedTo(repo, digest)
+		return nil, nil
+	case resp.StatusCode != http.StatusAccepted:
+		return nil, &statusError{code: resp.StatusCode}
+	case req.URL.Query().Get("mount") != "":
+		atomic.AddInt64(&t.mountsDeclined, 1)
+	}
+	return uploadLocation(resp)
+}
+
+// uploadChunks uploads data to the upload at location in PATCH requests of up to ChunkSize
+// bytes, and then completes the upload.
+func (t *OCI) uploadChunks(do Doer, location *url.URL, digest string, data []byte) error {
+	for offset := int64(0); offset < int64(len(data)); offset += t.ChunkSize {
+		end := offset + t.ChunkSize
+		if end > int64(len(data)) {
+			end = int64(len(data))
+		}
+		req, err := t.newRequest(http.MethodPatch, location.String(), bytes.NewReader(data[offset:end]))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/octet-stream")
+		req.Header.Set("Content-Range", fmt.Sprintf("%d-%d", offset, end-1))
+
+		resp, err := do.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusAccepted {
+			return &statusError{code: resp.StatusCode}
+		}
+		if location, err = uploadLocation(resp); err != nil {
+			return err
+		}
+	}
+	return t.completeUpload(do, location, digest, nil)
+}
+
+// completeUpload completes the upload at location with the last of the data of the blob, which
+// is all of it for monolithic uploads.
+func (t *OCI) completeUpload(do Doer, location *url.URL, digest string, data []byte) error {
+	u := *location
+	q := u.Query()
+	q.Set("digest", digest)
+	u.RawQuery = q.Encode()
+
+	req, err := t.newRequest(http.MethodPut, u.String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	return expect(do, req, http.StatusCreated)
+}
+
+// pushedTo records that repo has the blob with the given digest, for later mounts.
+func (t *OCI) pushedTo(repo, digest string) {
+	if !t.Mount {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.sources == nil {
+		t.sources = map[string]string{}
+	}
+	t.sources[digest] = repo
+}
+
+// source returns the repository that the blob with the given digest was last pushed to, if any.
+func (t *OCI) source(digest string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.sources[digest]
+}
+
+// uploadLocation returns the URL that the upload that resp responded to continues at.
+func uploadLocation(resp *http.Response) (*url.URL, error) {
+	location, err := resp.Location()
+	if err != nil {
+		return nil, fmt.Errorf("blob upload has no location: %w", err)
+	}
+	return location, nil
+}
@@ -0,0 +1,104 @@
+package pusher
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestOCIChunkedUpload(t *testing.T) {
+	reg := newOCIRegistry()
+	defer reg.Close()
+	target := NewOCI(reg.URL, "charts", "", "")
+	target.ChunkSize = 1000
+
+	pkg := ociChart(t, "chart", "0.1.0")
+	if err := target.Push(httpClient, "chart", "0.1.0", bytes.NewReader(pkg), int64(len(pkg))); err != nil {
+		t.Fatal(err)
+	}
+
+	// The registry checks that chunks follow each other and that the blobs match their digests.
+	patches, puts := 0, 0
+	for _, r := range reg.take(t) {
+		switch r {
+		case "PATCH blobs/uploads":
+			patches++
+		case "PUT blobs/uploads":
+			puts++
+		}
+	}
+	// The config blob is smaller than a chunk.
+	if want := (len(pkg)+999)/1000 + 1; patches != want || puts != 2 {
+		t.Errorf("%d PATCH and %d PUT requests for a %d byte chart, want %d and 2", patches, puts, len(pkg), want)
+	}
+	if target.blobsUploaded != 2 {
+		t.Errorf("%d blobs uploaded, want 2", target.blobsUploaded)
+	}
+}
+
+func TestOCIChunkedUploadReportsStatus(t *testing.T) {
+	reg := newOCIRegistry()
+	defer reg.Close()
+	reg.fail = map[string]int{"PATCH blobs/uploads": http.StatusRequestedRangeNotSatisfiable}
+	target := NewOCI(reg.URL, "charts", "", "")
+	target.ChunkSize = 1000
+
+	pkg := ociChart(t, "chart", "0.1.0")
+	err := target.Push(httpClient, "chart", "0.1.0", bytes.NewReader(pkg), int64(len(pkg)))
+	var se *statusError
+	if !errors.As(err, &se) || se.code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("push returned %v, want status 416", err)
+	}
+}
+
+func TestOCIMount(t *testing.T) {
+	tests := []struct {
+		name    string
+		decline bool
+		// copied has the requests that push the copy of the chart.
+		copied []string
+	}{
+		{
+			name:   "accepted",
+			copied: []string{"HEAD blobs", "POST blobs/uploads", "HEAD blobs", "POST blobs/uploads", "PUT manifests"},
+		},
+		{
+			name:    "declined",
+			decline: true,
+			copied: []string{"HEAD blobs", "POST blobs/uploads", "PUT blobs/uploads", "HEAD blobs", "POST blobs/uploads", "PUT blobs/uploads",
+				"PUT manifests"},
+		},
+	}
+	pkg := ociChart(t, "chart", "0.1.0")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := newOCIRegistry()
+			defer reg.Close()
+			reg.declineMounts = tt.decline
+			target := NewOCI(reg.URL, "charts", "", "")
+			target.Copies = 1
+			target.Mount = true
+
+			if err := target.Push(httpClient, "chart", "0.1.0", bytes.NewReader(pkg), int64(len(pkg))); err != nil {
+				t.Fatal(err)
+			}
+			requests := reg.take(t)
+			if got := requests[len(requests)-len(tt.copied):]; len(requests) != 7+len(tt.copied) || !reflect.DeepEqual(got, tt.copied) {
+				t.Errorf("requests are %v, want the copy pushed with %v", requests, tt.copied)
+			}
+			if _, ok := reg.manifests["charts-copy1/chart:0.1.0"]; !ok {
+				t.Error("copy was not pushed")
+			}
+
+			accepted, declined := int64(2), int64(0)
+			if tt.decline {
+				accepted, declined = 0, 2
+			}
+			if target.mountsAccepted != accepted || target.mountsDeclined != declined {
+				t.Errorf("%d mounts accepted and %d declined, want %d and %d", target.mountsAccepted, target.mountsDeclined, accepted, declined)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package pusher
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/wahabmk/helm-pusher/pkg/random"
+)
+
+const (
+	jsonSchemaDraft = "http://json-schema.org/draft-07/schema#"
+	// nestProbability is the probability that the next value starts a nested map, when the
+	// values are not nested as deeply as they may be.
+	nestProbability = 0.15
+	// unnestProbability is the probability that a nested map is closed before the next value.
+	unnestProbability = 0.1
+)
+
+// generateValues returns values of roughly size bytes when marshalled to YAML, with maps nested
+// up to depth levels. The values are a mix of strings, integers, numbers, booleans and lists.
+func generateValues(entropy *random.Entropy, size int64, depth int) map[string]interface{} {
+	if depth < 1 {
+		depth = 1
+	}
+
+	values := map[string]interface{}{}
+	// stack has the map that is currently being filled at the top.
+	stack := []map[string]interface{}{values}
+	var written int64
+	for i := 0; written < size; i++ {
+		key := fmt.Sprintf("%s%d", fillerWords[entropy.Intn(len(fillerWords))], i)
+		indent := int64(2 * (len(stack) - 1))
+
+		switch f := entropy.Float64(); {
+		case len(stack) < depth && f < nestProbability:
+			nested := map[string]interface{}{}
+			stack[len(stack)-1][key] = nested
+			stack = append(stack, nested)
+			written += indent + int64(len(key)) + 2
+			continue
+		case len(stack) > 1 && f < nestProbability+unnestProbability:
+			stack = stack[:len(stack)-1]
+		}
+
+		value := generateValue(entropy)
+		stack[len(stack)-1][key] = value
+		// Account for the indentation, separator and newline of each entry.
+		written += indent + int64(len(key)+len(fmt.Sprint(value))) + 3
+		if list, ok := value.([]interface{}); ok {
+			written += int64(len(list)) * (indent + 5)
+		}
+	}
+	return values
+}
+
+func generateValue(entropy *random.Entropy) interface{} {
+	switch entropy.Intn(6) {
+	case 0:
+		return entropy.Intn(10000)
+	case 1:
+		return math.Round(entropy.Float64()*1000) / 100
+	case 2:
+		return entropy.Intn(2) == 0
+	case 3:
+		list := make([]interface{}, 1+entropy.Intn(4))
+		for i := range list {
+			list[i] = fillerWords[entropy.Intn(len(fillerWords))]
+		}
+		return list
+	default:
+		return fmt.Sprintf("%s-%d", fillerWords[entropy.Intn(len(fillerWords))], entropy.Intn(100000))
+	}
+}
+
+// generateSchema returns a JSON schema that the values of the named chart conform to.
+func generateSchema(name string, values map[string]interface{}) map[string]interface{} {
+	schema := schemaFor(values)
+	schema["$schema"] = jsonSchemaDraft
+	schema["title"] = fmt.Sprintf("Values of %s", name)
+	return schema
+}
+
+func schemaFor(v interface{}) map[string]interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		properties := map[string]interface{}{}
+		required := make([]string, 0, len(v))
+		for key, value := range v {
+			properties[key] = schemaFor(value)
+			required = append(required, key)
+		}
+		sort.Strings(required)
+		return map[string]interface{}{
+			"type":       "object",
+			"properties": properties,
+			"required":   required,
+		}
+	case []interface{}:
+		items := map[string]interface{}{}
+		if len(v) > 0 {
+			items = schemaFor(v[0])
+		}
+		return map[string]interface{}{"type": "array", "items": items}
+	case string:
+		// Strings that are empty in the sample, such as the image tag of the scaffold, may stay empty.
+		if v == "" {
+			return map[string]interface{}{"type": "string"}
+		}
+		return map[string]interface{}{"type": "string", "minLength": 1}
+	case bool:
+		return map[string]interface{}{"type": "boolean"}
+	case int, int64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case float64:
+		if v == math.Trunc(v) {
+			return map[string]interface{}{"type": "number"}
+		}
+		return map[string]interface{}{"type": "number", "minimum": 0}
+	case nil:
+		return map[string]interface{}{"type": "null"}
+	default:
+		// Values loaded by YAML parsers can have other types, which the schema does not restrict.
+		return map[string]interface{}{}
+	}
+}
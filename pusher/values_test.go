@@ -0,0 +1,19 @@
+package pusher
+
+import (
+	"encoding/json"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+func TestGeneratedSchemaAcceptsValues(t *testing.T) {
+	c := scaffold(t)
+	schema, err := json.Marshal(generateSchema(c.Name(), c.Values))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := chartutil.ValidateAgainstSingleSchema(c.Values, schema); err != nil {
+		t.Errorf("values of the scaffold do not conform to their schema: %v", err)
+	}
+}
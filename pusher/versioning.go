@@ -0,0 +1,166 @@
+package pusher
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/wahabmk/helm-pusher/pkg/random"
+)
+
+var (
+	// prereleaseStages are the prerelease identifiers that a release train goes through, in order.
+	prereleaseStages = []string{"alpha", "beta", "rc"}
+)
+
+// Versioner generates the successive versions of a chart. Versioners are shared by routines
+// the same way as Namers.
+type Versioner interface {
+	// Next returns the version that follows previous, which is nil for the first version of a chart.
+	Next(entropy *random.Entropy, previous *semver.Version) (*semver.Version, error)
+	String() string
+}
+
+// ParseVersioner returns the versioning strategy described by s, which is one of:
+//
+//	random
+//	train
+//	train:<minor probability>:<major probability>:<prerelease probability>:<build probability>
+func ParseVersioner(s string) (Versioner, error) {
+	parts := strings.Split(s, ":")
+	switch {
+	case parts[0] == "random" && len(parts) == 1:
+		return RandomVersioner{}, nil
+	case parts[0] == "train" && len(parts) == 1:
+		return DefaultTrainVersioner, nil
+	case parts[0] == "train" && len(parts) == 5:
+		var p [4]float64
+		for i, arg := range parts[1:] {
+			f, err := strconv.ParseFloat(arg, 64)
+			if err != nil || f < 0 || f > 1 {
+				return nil, fmt.Errorf("invalid probability %q", arg)
+			}
+			p[i] = f
+		}
+		return TrainVersioner{Minor: p[0], Major: p[1], Prerelease: p[2], Build: p[3]}, nil
+	default:
+		return nil, fmt.Errorf("unknown versioning strategy %q", s)
+	}
+}
+
+// RandomVersioner generates unrelated versions with huge random major, minor and patch numbers
+// and a ULID prerelease.
+type RandomVersioner struct{}
+
+func (RandomVersioner) Next(entropy *random.Entropy, _ *semver.Version) (*semver.Version, error) {
+	major := rand.Int63()
+	minor := rand.Int63()
+	patch := rand.Int63()
+	prerelease, err := entropy.String()
+	if err != nil {
+		return nil, fmt.Errorf("error generating prerelease: %w", err)
+	}
+
+	return semver.NewVersion(fmt.Sprintf("%d.%d.%d-%s", major, minor, patch, prerelease))
+}
+
+func (RandomVersioner) String() string {
+	return "random"
+}
+
+// TrainVersioner generates monotonically increasing versions like a release train, starting at
+// 1.0.0. Each release bumps the patch version, unless the minor or major version is bumped with
+// the given probabilities. A release is preceded by alpha, beta and rc prereleases with the
+// Prerelease probability, and any version has build metadata with the Build probability.
+type TrainVersioner struct {
+	Minor      float64
+	Major      float64
+	Prerelease float64
+	Build      float64
+}
+
+var (
+	DefaultTrainVersioner = TrainVersioner{Minor: 0.2, Major: 0.02, Prerelease: 0.2, Build: 0.05}
+)
+
+func (t TrainVersioner) Next(entropy *random.Entropy, previous *semver.Version) (*semver.Version, error) {
+	var (
+		next semver.Version
+		err  error
+	)
+
+	if previous == nil {
+		next = *semver.MustParse("1.0.0")
+		if next, err = t.maybePrerelease(entropy, next); err != nil {
+			return nil, err
+		}
+	} else if stage, n, ok := parsePrerelease(previous.Prerelease()); ok {
+		// Either iterate on the prerelease, move on to the next stage or release it.
+		switch {
+		case entropy.Float64() < 0.5:
+			next, err = previous.SetPrerelease(fmt.Sprintf("%s.%d", prereleaseStages[stage], n+1))
+		case stage < len(prereleaseStages)-1:
+			next, err = previous.SetPrerelease(prereleaseStages[stage+1] + ".1")
+		default:
+			next = previous.IncPatch()
+		}
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		switch f := entropy.Float64(); {
+		case f < t.Major:
+			next = previous.IncMajor()
+		case f < t.Major+t.Minor:
+			next = previous.IncMinor()
+		default:
+			next = previous.IncPatch()
+		}
+		if next, err = t.maybePrerelease(entropy, next); err != nil {
+			return nil, err
+		}
+	}
+
+	next, err = next.SetMetadata("")
+	if err == nil && entropy.Float64() < t.Build {
+		next, err = next.SetMetadata(fmt.Sprintf("build.%d", entropy.Intn(100000)))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &next, nil
+}
+
+// maybePrerelease turns v into the first prerelease of a randomly picked stage, with the Prerelease probability.
+func (t TrainVersioner) maybePrerelease(entropy *random.Entropy, v semver.Version) (semver.Version, error) {
+	if entropy.Float64() >= t.Prerelease {
+		return v, nil
+	}
+	return v.SetPrerelease(prereleaseStages[entropy.Intn(len(prereleaseStages))] + ".1")
+}
+
+func (t TrainVersioner) String() string {
+	return fmt.Sprintf("release train (%.2f perc minor, %.2f perc major, %.2f perc prerelease, %.2f perc build metadata)",
+		t.Minor*100, t.Major*100, t.Prerelease*100, t.Build*100)
+}
+
+// parsePrerelease returns the stage and number of a prerelease such as "beta.2".
+func parsePrerelease(pre string) (stage int, n int, ok bool) {
+	parts := strings.Split(pre, ".")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	n, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, false
+	}
+	for i, s := range prereleaseStages {
+		if s == parts[0] {
+			return i, n, true
+		}
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,84 @@
+package pusher
+
+import (
+	"testing"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/wahabmk/helm-pusher/pkg/random"
+)
+
+func TestTrainVersionerBumps(t *testing.T) {
+	tests := []struct {
+		name string
+		v    TrainVersioner
+		want []string
+	}{
+		{"patch", TrainVersioner{}, []string{"1.0.0", "1.0.1", "1.0.2", "1.0.3"}},
+		{"minor", TrainVersioner{Minor: 1}, []string{"1.0.0", "1.1.0", "1.2.0", "1.3.0"}},
+		{"major", TrainVersioner{Major: 1}, []string{"1.0.0", "2.0.0", "3.0.0", "4.0.0"}},
+	}
+	for _, tt := range tests {
+		entropy := random.New(1)
+		var previous *semver.Version
+		for _, want := range tt.want {
+			next, err := tt.v.Next(entropy, previous)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if next.String() != want {
+				t.Errorf("%s release after %v is %s, want %s", tt.name, previous, next, want)
+			}
+			previous = next
+		}
+	}
+}
+
+func TestTrainVersionerReleasesPrereleases(t *testing.T) {
+	tests := []struct {
+		previous string
+		// next are the versions that may follow previous.
+		next []string
+	}{
+		{"1.2.3-alpha.1", []string{"1.2.3-alpha.2", "1.2.3-beta.1"}},
+		{"1.2.3-beta.4", []string{"1.2.3-beta.5", "1.2.3-rc.1"}},
+		// The last prerelease is released as the version it precedes, rather than the one after.
+		{"1.2.3-rc.2", []string{"1.2.3-rc.3", "1.2.3"}},
+		{"1.2.3-rc.2+build.7", []string{"1.2.3-rc.3", "1.2.3"}},
+	}
+	v := TrainVersioner{Minor: 0.3, Major: 0.3}
+	entropy := random.New(1)
+	for _, tt := range tests {
+		previous := semver.MustParse(tt.previous)
+		seen := map[string]int{}
+		for i := 0; i < 100; i++ {
+			next, err := v.Next(entropy, previous)
+			if err != nil {
+				t.Fatal(err)
+			}
+			seen[next.String()]++
+		}
+		for _, want := range tt.next {
+			if seen[want] == 0 {
+				t.Errorf("%s was never followed by %s, got %v", tt.previous, want, seen)
+			}
+		}
+		if len(seen) != len(tt.next) {
+			t.Errorf("%s was followed by %v, want only %v", tt.previous, seen, tt.next)
+		}
+	}
+}
+
+func TestTrainVersionerIncreases(t *testing.T) {
+	entropy := random.New(1)
+	var previous *semver.Version
+	for i := 0; i < 1000; i++ {
+		next, err := DefaultTrainVersioner.Next(entropy, previous)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if previous != nil && !next.GreaterThan(previous) {
+			t.Fatalf("%s follows %s", next, previous)
+		}
+		previous = next
+	}
+}